@@ -0,0 +1,102 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/otamoe/gin-server/errs"
+)
+
+// Warm 部分文件失败, Params 的 failed 为 unique => 错误信息
+var ErrStorageWarm = &errs.Error{
+	Message:    "Storage: Warm failed",
+	Path:       "storage",
+	Type:       "warm",
+	StatusCode: http.StatusBadGateway,
+}
+
+// GetMany 并发调用 Get, 单个失败记录在对应 Storage.Errors 中, 不影响其他
+func GetMany(ctx context.Context, vals []string, cache bool, save bool) (storages map[string]*Storage, err error) {
+	return defaultClient().GetMany(ctx, vals, cache, save)
+}
+
+func (client *Client) GetMany(ctx context.Context, vals []string, cache bool, save bool) (storages map[string]*Storage, err error) {
+	storages = map[string]*Storage{}
+
+	concurrency := GetManyConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < concurrency && i < len(vals); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for val := range queue {
+				storage, e := client.Get(ctx, val, cache, save)
+				if storage == nil {
+					storage = &Storage{Unique: val}
+				}
+				if e != nil && len(storage.Errors) == 0 {
+					storage.addError(e)
+				}
+				mu.Lock()
+				storages[val] = storage
+				mu.Unlock()
+			}
+		}()
+	}
+
+	seen := map[string]bool{}
+loop:
+	for _, val := range vals {
+		if seen[val] {
+			continue
+		}
+		seen[val] = true
+		select {
+		case <-ctx.Done():
+			err = contextError(ctx, ctx.Err())
+			break loop
+		case queue <- val:
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return
+}
+
+func Warm(ctx context.Context, vals []string) (err error) {
+	return defaultClient().Warm(ctx, vals)
+}
+
+// Warm 使用 GetMany 回源并写入缓存, 忽略不存在的文件, 其他失败汇总到 ErrStorageWarm 的 Params
+func (client *Client) Warm(ctx context.Context, vals []string) (err error) {
+	var storages map[string]*Storage
+	if storages, err = client.GetMany(ctx, vals, true, true); err != nil {
+		return
+	}
+	failed := map[string]string{}
+	var first error
+	for val, storage := range storages {
+		e := storage.Err()
+		if e == nil || errors.Is(e, ErrStorageNotFound) {
+			continue
+		}
+		failed[val] = e.Error()
+		if first == nil {
+			first = e
+		}
+	}
+	if first != nil {
+		wrapped := wrapError(ErrStorageWarm, first)
+		wrapped.GinError.Params = map[string]interface{}{"failed": failed}
+		err = wrapped
+	}
+	return
+}
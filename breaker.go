@@ -0,0 +1,133 @@
+package model
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/otamoe/gin-server/errs"
+)
+
+type (
+	breaker struct {
+		state    string
+		failures int
+		openedAt time.Time
+		probing  bool
+	}
+
+	breakerGroup struct {
+		mu       sync.Mutex
+		breakers map[string]*breaker
+	}
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+const (
+	breakerNone = iota
+	breakerSuccess
+	breakerFailure
+)
+
+var (
+	// 源站连续失败 BreakerThreshold 次后熔断 BreakerCooldown, 之后放行一个请求探测, 0 不熔断
+	BreakerThreshold int
+	BreakerCooldown  = time.Second * 30
+
+	ErrStorageCircuitOpen error = &errs.Error{
+		Message:    "Storage: Circuit breaker is open",
+		Path:       "storage",
+		Type:       "circuit_open",
+		StatusCode: http.StatusServiceUnavailable,
+	}
+
+	breakers = &breakerGroup{}
+)
+
+// 熔断按 scheme://host 区分源站
+func breakerKey(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func (group *breakerGroup) allow(key string) bool {
+	if BreakerThreshold <= 0 {
+		return true
+	}
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	b := group.get(key)
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < BreakerCooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (group *breakerGroup) done(key string, result int) {
+	if BreakerThreshold <= 0 {
+		return
+	}
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	b := group.get(key)
+	switch result {
+	case breakerSuccess:
+		b.state = BreakerClosed
+		b.failures = 0
+	case breakerFailure:
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= BreakerThreshold {
+			b.state = BreakerOpen
+			b.openedAt = time.Now()
+		}
+	}
+	b.probing = false
+}
+
+func (group *breakerGroup) get(key string) *breaker {
+	if group.breakers == nil {
+		group.breakers = map[string]*breaker{}
+	}
+	b, ok := group.breakers[key]
+	if !ok {
+		b = &breaker{state: BreakerClosed}
+		group.breakers[key] = b
+	}
+	return b
+}
+
+func (group *breakerGroup) states() (states map[string]string) {
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	states = map[string]string{}
+	for key, b := range group.breakers {
+		state := b.state
+		if state == BreakerOpen && time.Since(b.openedAt) >= BreakerCooldown {
+			state = BreakerHalfOpen
+		}
+		states[key] = state
+	}
+	return
+}
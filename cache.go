@@ -0,0 +1,56 @@
+package model
+
+import (
+	"context"
+
+	"github.com/globalsign/mgo"
+	mgoModel "github.com/otamoe/mgo-model"
+)
+
+type (
+	// Get 读取缓存的后端, 返回的 Storage 可以是 404 的缓存, 是否过期由 Get 判断
+	Cache interface {
+		Get(ctx context.Context, unique string) (storage *Storage, ok bool)
+		Set(ctx context.Context, unique string, storage *Storage)
+	}
+
+	// 读取 ModelStorage, 回源结果由 Get 的 save 写入, Set 不做任何操作
+	MongoCache struct {
+		// 读取缓存使用的 read preference, 例如 mgo.SecondaryPreferred, 写入仍然使用 primary
+		// 0 时使用 context 中 session 的模式
+		// 从节点可能落后于主节点, 刚写入或删除的文档可能读不到或读到旧的版本, 过期判断也以旧的版本为准
+		Mode mgo.Mode
+	}
+)
+
+var DefaultCache Cache = MongoCache{}
+
+func (cache MongoCache) Get(ctx context.Context, unique string) (storage *Storage, ok bool) {
+	if cache.Mode != 0 {
+		if session, ok2 := ctx.Value(mgoModel.CONTEXT).(*mgo.Session); ok2 {
+			session = session.Copy()
+			defer session.Close()
+			session.SetMode(cache.Mode, true)
+			ctx = context.WithValue(ctx, mgoModel.CONTEXT, session)
+		}
+	}
+	storage = &Storage{}
+	if err := ModelStorage.Query(ctx).Eq("unique", unique).One(storage); err != nil {
+		if err != mgo.ErrNotFound {
+			Logger.WithError(err).WithField("unique", unique).Warn("[Storage] cache get")
+		}
+		return nil, false
+	}
+	ok = true
+	return
+}
+
+func (MongoCache) Set(ctx context.Context, unique string, storage *Storage) {
+}
+
+func (client *Client) getCache() Cache {
+	if client.cache != nil {
+		return client.cache
+	}
+	return MongoCache{}
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type (
+	// 删除或 banned 时清除 CDN 缓存
+	// 接入 CDN 时实现 Purge 并设置 DefaultCDNPurger, 例如调用 CDN 服务商的刷新接口
+	CDNPurger interface {
+		Purge(ctx context.Context, urls []string) error
+	}
+
+	NopCDNPurger struct{}
+)
+
+var (
+	DefaultCDNPurger CDNPurger = NopCDNPurger{}
+
+	// Purge 失败时的重试次数和间隔, 0 不重试
+	CDNPurgeMaxRetries int
+	CDNPurgeRetryDelay = 5 * time.Second
+)
+
+func (NopCDNPurger) Purge(ctx context.Context, urls []string) error {
+	return nil
+}
+
+// 在后台清除, 失败只记录日志, 不影响删除和修改状态
+func purgeCDN(ctx context.Context, storage *Storage) {
+	purger := DefaultCDNPurger
+	if purger == nil {
+		return
+	}
+	if _, ok := purger.(NopCDNPurger); ok {
+		return
+	}
+	urls := defaultClient().purgeURLs(storage)
+	if len(urls) == 0 {
+		return
+	}
+	go func() {
+		ctx := detachedContext{ctx}
+		for i := 0; ; i++ {
+			err := purger.Purge(ctx, urls)
+			if err == nil {
+				return
+			}
+			entry := Logger.WithError(err).WithFields(logrus.Fields{
+				"unique":  storage.Unique,
+				"attempt": i + 1,
+			})
+			if i >= CDNPurgeMaxRetries {
+				entry.Error("[Storage] cdn purge")
+				return
+			}
+			entry.Warn("[Storage] cdn purge retry")
+			time.Sleep(CDNPurgeRetryDelay)
+		}
+	}()
+}
+
+// 文件, variants, 字幕, 音轨和 HLS, DASH 播放列表的地址
+// HLS 分片的地址不储存, 需要由 CDNPurger 按播放列表的目录前缀清除
+func (client *Client) purgeURLs(storage *Storage) (urls []string) {
+	exists := map[string]bool{}
+	add := func(url string) {
+		if url != "" && !exists[url] {
+			exists[url] = true
+			urls = append(urls, url)
+		}
+	}
+	if url, _, err := client.url(storage.Unique); err == nil {
+		add(url)
+	}
+	paths := []string{storage.Path, storage.HLS, storage.DASH}
+	for _, variant := range storage.Variants {
+		paths = append(paths, variant.Path)
+	}
+	for _, track := range append(append([]Track(nil), storage.Subtitles...), storage.AudioTracks...) {
+		paths = append(paths, track.Path)
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if url, _, err := client.pathURL(storage, path); err == nil {
+			add(url)
+		}
+	}
+	return
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	mgoModel "github.com/otamoe/mgo-model"
+)
+
+// Changed 比较两个文档除时间, version 等由数据库维护的字段以外是否有变化
+func Changed(a, b *Storage) bool {
+	if a == nil || b == nil {
+		return a != b
+	}
+	return !reflect.DeepEqual(a.material(), b.material())
+}
+
+// 去掉不需要比较的字段
+func (storage *Storage) material() (val Storage) {
+	val = *storage
+	val.DocumentBase = mgoModel.DocumentBase{}
+	val.ID = ""
+	val.IncludeHLSKey = false
+	val.Version = 0
+	val.CreatedAt = nil
+	val.UpdatedAt = nil
+	val.DeletedAt = nil
+	val.ExpiresAt = nil
+	val.err = nil
+	return
+}
+
+// 没有变化时只刷新 updated_at, expires_at, 不写入整个文档
+func (storage *Storage) touchUnchanged(ctx context.Context, old *Storage) (err error) {
+	now := time.Now().UTC()
+	update := bson.M{"$set": bson.M{"updated_at": now, "expires_at": storage.ExpiresAt}}
+	if storage.ExpiresAt == nil {
+		update = bson.M{"$set": bson.M{"updated_at": now}, "$unset": bson.M{"expires_at": ""}}
+	}
+	if err = ModelStorage.Query(ctx).ID(old.ID).Update(update); err != nil {
+		return
+	}
+	storage.Version = old.Version
+	storage.CreatedAt = old.CreatedAt
+	storage.UpdatedAt = &now
+	storage.New(ctx, ModelStorage, storage, false)
+	return
+}
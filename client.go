@@ -0,0 +1,202 @@
+package model
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type (
+	Client struct {
+		storageOrigins     []string
+		storagePathOrigins []string
+		maxOriginAttempts  int
+		originSelector     OriginSelector
+		username           string
+		password           string
+		bearerToken        string
+
+		timeout          time.Duration
+		maxRetries       int
+		retryBaseDelay   time.Duration
+		maxResponseBytes int64
+
+		headers    http.Header
+		httpClient *http.Client
+		fetcher    Fetcher
+		cache      Cache
+	}
+
+	Option func(client *Client)
+)
+
+func NewClient(opts ...Option) (client *Client) {
+	client = &Client{
+		originSelector:   DefaultOriginSelector,
+		timeout:          DefaultFetchTimeout,
+		retryBaseDelay:   DefaultFetchRetryBaseDelay,
+		maxResponseBytes: DefaultMaxResponseBytes,
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	return
+}
+
+func WithOrigin(storageOrigin, storagePathOrigin string) Option {
+	return func(client *Client) {
+		client.storageOrigins = joinOrigins(storageOrigin, nil)
+		client.storagePathOrigins = joinOrigins(storagePathOrigin, nil)
+	}
+}
+
+// 多个源站按顺序失败转移, maxAttempts <= 0 时尝试全部
+func WithOrigins(storageOrigins, storagePathOrigins []string, maxAttempts int) Option {
+	return func(client *Client) {
+		client.storageOrigins = joinOrigins("", storageOrigins)
+		client.storagePathOrigins = joinOrigins("", storagePathOrigins)
+		client.maxOriginAttempts = maxAttempts
+	}
+}
+
+func WithCredentials(username, password string) Option {
+	return func(client *Client) {
+		client.username = username
+		client.password = password
+	}
+}
+
+func WithBearerToken(token string) Option {
+	return func(client *Client) {
+		client.bearerToken = token
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(client *Client) {
+		client.timeout = timeout
+	}
+}
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = httpClient
+	}
+}
+
+func WithRetry(maxRetries int, baseDelay time.Duration) Option {
+	return func(client *Client) {
+		client.maxRetries = maxRetries
+		client.retryBaseDelay = baseDelay
+	}
+}
+
+func WithMaxResponseBytes(maxResponseBytes int64) Option {
+	return func(client *Client) {
+		client.maxResponseBytes = maxResponseBytes
+	}
+}
+
+func WithHeaders(headers http.Header) Option {
+	return func(client *Client) {
+		client.headers = headers
+	}
+}
+
+func WithOriginSelector(selector OriginSelector) Option {
+	return func(client *Client) {
+		client.originSelector = selector
+	}
+}
+
+func WithCache(cache Cache) Option {
+	return func(client *Client) {
+		client.cache = cache
+	}
+}
+
+func WithFetcher(fetcher Fetcher) Option {
+	return func(client *Client) {
+		client.fetcher = fetcher
+	}
+}
+
+// 包级别函数使用的 client, 每次调用时读取包变量保持兼容
+func defaultClient() *Client {
+	return &Client{
+		storageOrigins:     joinOrigins(StorageOrigin, StorageOrigins),
+		storagePathOrigins: joinOrigins(StoragePathOrigin, StoragePathOrigins),
+		maxOriginAttempts:  MaxOriginAttempts,
+		originSelector:     DefaultOriginSelector,
+		username:           Username,
+		password:           Password,
+		bearerToken:        BearerToken,
+		timeout:            FetchTimeout,
+		maxRetries:         FetchMaxRetries,
+		retryBaseDelay:     FetchRetryBaseDelay,
+		maxResponseBytes:   MaxResponseBytes,
+		headers:            FetchHeaders,
+		httpClient:         HTTPClient,
+		fetcher:            DefaultFetcher,
+		cache:              DefaultCache,
+	}
+}
+
+// 去掉空值和重复的源站
+func joinOrigins(origin string, origins []string) (values []string) {
+	for _, val := range append([]string{origin}, origins...) {
+		if val == "" {
+			continue
+		}
+		exists := false
+		for _, val2 := range values {
+			if val2 == val {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			values = append(values, val)
+		}
+	}
+	return
+}
+
+func (client *Client) fetchTimeout(ctx context.Context) (timeout time.Duration) {
+	if val, ok := ctx.Value(CONTEXT_FETCH_TIMEOUT).(time.Duration); ok && val > 0 {
+		timeout = val
+		return
+	}
+	timeout = client.timeout
+	if timeout <= 0 {
+		timeout = DefaultFetchTimeout
+	}
+	return
+}
+
+// nil 时使用 client 自身的 http 实现
+func (client *Client) getFetcher() Fetcher {
+	if client.fetcher == client {
+		return nil
+	}
+	return client.fetcher
+}
+
+// 先写入 client 的 header 再写入 ctx 的, 之后设置的认证等 header 会覆盖
+func (client *Client) setHeaders(ctx context.Context, req *http.Request) {
+	for key, vals := range client.headers {
+		req.Header[http.CanonicalHeaderKey(key)] = append([]string(nil), vals...)
+	}
+	if headers, ok := ctx.Value(CONTEXT_FETCH_HEADERS).(http.Header); ok {
+		for key, vals := range headers {
+			req.Header[http.CanonicalHeaderKey(key)] = append([]string(nil), vals...)
+		}
+	}
+}
+
+func (client *Client) getHTTPClient() *http.Client {
+	if client.httpClient != nil {
+		return client.httpClient
+	}
+	return defaultHTTPClient
+}
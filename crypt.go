@@ -0,0 +1,128 @@
+package model
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+type (
+	// 写入数据库时使用 HLSKeyEncryptionKey 加密, 读取时解密, 内存中和 json 都是明文
+	EncryptedString string
+)
+
+const encryptedPrefix = "enc:v1:"
+
+var (
+	// AES 密钥 16, 24, 32 字节, 为空时明文储存
+	HLSKeyEncryptionKey []byte
+
+	errEncryptionKeyMissing = errors.New("storage-model.HLSKeyEncryptionKey is required to decrypt")
+	errEncryptedInvalid     = errors.New("storage-model: invalid encrypted value")
+)
+
+func (val EncryptedString) GetBSON() (interface{}, error) {
+	if val == "" || len(HLSKeyEncryptionKey) == 0 {
+		return string(val), nil
+	}
+	return encryptString(string(val))
+}
+
+// 兼容没有加密的旧数据
+func (val *EncryptedString) SetBSON(raw bson.Raw) (err error) {
+	var s string
+	if err = raw.Unmarshal(&s); err != nil {
+		return
+	}
+	if !strings.HasPrefix(s, encryptedPrefix) {
+		*val = EncryptedString(s)
+		return
+	}
+	if s, err = decryptString(s); err != nil {
+		return
+	}
+	*val = EncryptedString(s)
+	return
+}
+
+func encryptionAEAD() (aead cipher.AEAD, err error) {
+	var block cipher.Block
+	if block, err = aes.NewCipher(HLSKeyEncryptionKey); err != nil {
+		return
+	}
+	aead, err = cipher.NewGCM(block)
+	return
+}
+
+// enc:v1: + base64(nonce + ciphertext)
+func encryptString(plaintext string) (s string, err error) {
+	var aead cipher.AEAD
+	if aead, err = encryptionAEAD(); err != nil {
+		return
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+	s = encryptedPrefix + base64.RawStdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(plaintext), nil))
+	return
+}
+
+func decryptString(s string) (plaintext string, err error) {
+	if len(HLSKeyEncryptionKey) == 0 {
+		err = errEncryptionKeyMissing
+		return
+	}
+	var aead cipher.AEAD
+	if aead, err = encryptionAEAD(); err != nil {
+		return
+	}
+	var data []byte
+	if data, err = base64.RawStdEncoding.DecodeString(strings.TrimPrefix(s, encryptedPrefix)); err != nil {
+		return
+	}
+	if len(data) < aead.NonceSize() {
+		err = errEncryptedInvalid
+		return
+	}
+	var b []byte
+	if b, err = aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil); err != nil {
+		return
+	}
+	plaintext = string(b)
+	return
+}
+
+// 加密已有的明文 hls_key, dash_key, 返回更新的数量
+func EncryptHLSKeys(ctx context.Context) (n int, err error) {
+	if len(HLSKeyEncryptionKey) == 0 {
+		err = errEncryptionKeyMissing
+		return
+	}
+	plain := bson.RegEx{Pattern: "^" + encryptedPrefix}
+	for _, field := range []string{"hls_key", "dash_key"} {
+		query := bson.M{field: bson.M{"$exists": true, "$ne": "", "$not": plain}}
+		iter := ModelStorage.DB(ctx).Find(query).Select(bson.M{field: 1}).Iter()
+		var doc bson.M
+		for iter.Next(&doc) {
+			val, _ := doc[field].(string)
+			if err = ModelStorage.DB(ctx).Update(bson.M{"_id": doc["_id"], field: val}, bson.M{"$set": bson.M{field: EncryptedString(val)}}); err != nil {
+				iter.Close()
+				return
+			}
+			n++
+			doc = nil
+		}
+		if err = iter.Close(); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/otamoe/gin-server/errs"
+)
+
+type (
+	dashMPD struct {
+		MediaPresentationDuration string `xml:"mediaPresentationDuration,attr"`
+		Periods                   []struct {
+			AdaptationSets []struct {
+				Representations []struct{} `xml:"Representation"`
+			} `xml:"AdaptationSet"`
+		} `xml:"Period"`
+	}
+)
+
+var (
+	// 回源后读取 DASH 清单, 总时长和 Representation 数量写入 Meta 的 dash_duration, dash_representations
+	// 需要额外请求一次源站, 默认关闭
+	ParseDASH bool
+
+	ErrStorageDASHInvalid = &errs.Error{
+		Message:    "Storage: Invalid DASH manifest",
+		Path:       "dash",
+		Type:       "invalid",
+		StatusCode: http.StatusBadGateway,
+	}
+
+	// ISO 8601 duration, 例如 PT1H2M3.5S
+	dashDurationRegexp = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+)
+
+func (client *Client) parseDASH(ctx context.Context, storage *Storage) (err error) {
+	var data []byte
+	if data, err = client.fetchManifest(ctx, storage, storage.DASH); err != nil {
+		return
+	}
+	var mpd dashMPD
+	if err = xml.Unmarshal(data, &mpd); err != nil {
+		err = wrapError(ErrStorageDASHInvalid, err)
+		return
+	}
+	var representations int
+	for _, period := range mpd.Periods {
+		for _, set := range period.AdaptationSets {
+			representations += len(set.Representations)
+		}
+	}
+	if representations == 0 {
+		err = ErrStorageDASHInvalid
+		return
+	}
+	if storage.Meta == nil {
+		storage.Meta = map[string]interface{}{}
+	}
+	storage.Meta["dash_representations"] = representations
+	if duration, ok := parseDASHDuration(mpd.MediaPresentationDuration); ok {
+		storage.Meta["dash_duration"] = duration
+	}
+	return
+}
+
+// 返回秒数, 不支持年和月
+func parseDASHDuration(val string) (seconds float64, ok bool) {
+	matches := dashDurationRegexp.FindStringSubmatch(val)
+	if matches == nil || val == "P" || val == "PT" {
+		return
+	}
+	for i, unit := range []float64{86400, 3600, 60, 1} {
+		if matches[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(matches[i+1], 64)
+		if err != nil {
+			return
+		}
+		seconds += n * unit
+	}
+	ok = true
+	return
+}
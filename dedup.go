@@ -0,0 +1,111 @@
+package model
+
+import (
+	"context"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// 开启后插入时 SHA256 相同的文件共用第一个文件的 Path, 第一个文件的 RefCount 记录引用数量
+var Dedup bool
+
+// 插入前查找 SHA256 相同的文件, 存在时增加引用计数并指向它的 Path
+func (storage *Storage) dedup() (err error) {
+	if !Dedup || storage.SHA256 == "" || storage.Blob != "" {
+		return
+	}
+	ctx := storage.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	blob := &Storage{}
+	update := bson.M{"$inc": bson.M{"ref_count": 1}}
+	err = ModelStorage.Query(ctx).
+		Eq("sha256", storage.SHA256).
+		Gt("ref_count", 0).
+		Sort("_id").
+		UpdateAndFind(update, blob, true)
+	if err == mgo.ErrNotFound {
+		storage.RefCount = 1
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	storage.deduped = true
+	storage.dedupPath = storage.Path
+	storage.Blob = blob.ID
+	storage.Path = blob.Path
+	storage.RefCount = 0
+	return
+}
+
+// 插入失败时归还 dedup 增加的引用计数
+func (storage *Storage) Insert() (err error) {
+	err = storage.DocumentBase.Insert()
+	if err != nil && storage.deduped {
+		ctx := storage.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if e := releaseBlob(ctx, storage); e != nil {
+			Logger.WithError(e).WithField("unique", storage.Unique).Warn("[Storage] dedup release")
+		}
+		storage.Blob = ""
+		storage.Path = storage.dedupPath
+	}
+	storage.deduped = false
+	storage.dedupPath = ""
+	return
+}
+
+// 引用计数所在的文件, 没有参与去重时返回空
+func (storage *Storage) blobID() bson.ObjectId {
+	if storage.Blob != "" {
+		return storage.Blob
+	}
+	if storage.RefCount > 0 {
+		return storage.ID
+	}
+	return ""
+}
+
+// 删除时减少引用计数, 为 0 时标记 PendingGC 等待回收
+func releaseBlob(ctx context.Context, storage *Storage) (err error) {
+	id := storage.blobID()
+	if id == "" {
+		return
+	}
+	blob := &Storage{}
+	if err = ModelStorage.Query(ctx).ID(id).Gt("ref_count", 0).UpdateAndFind(bson.M{"$inc": bson.M{"ref_count": -1}}, blob, true); err != nil {
+		if err == mgo.ErrNotFound {
+			err = nil
+		}
+		return
+	}
+	if blob.RefCount > 0 {
+		return
+	}
+	if err = ModelStorage.Query(ctx).ID(id).Eq("ref_count", 0).Update(bson.M{"$set": bson.M{"pending_gc": true}}); err == mgo.ErrNotFound {
+		err = nil
+	}
+	return
+}
+
+// 恢复时重新增加引用计数
+func retainBlob(ctx context.Context, storage *Storage) (err error) {
+	id := storage.blobID()
+	if id == "" {
+		return
+	}
+	update := bson.M{
+		"$inc":   bson.M{"ref_count": 1},
+		"$unset": bson.M{"pending_gc": ""},
+	}
+	if err = ModelStorage.Query(ctx).ID(id).Update(update); err == mgo.ErrNotFound {
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/otamoe/gin-server/errs"
+)
+
+var (
+	ErrStorageParentNotFound = &errs.Error{
+		Message:    "Parent storage not found",
+		Path:       "parent",
+		Type:       "not_found",
+		StatusCode: http.StatusBadRequest,
+	}
+
+	// 级联删除衍生文件失败, Params 的 deleted 为已经删除的数量
+	ErrStorageCascadeDelete = &errs.Error{
+		Message:    "Failed to delete derivatives",
+		Path:       "parent",
+		Type:       "cascade",
+		StatusCode: http.StatusInternalServerError,
+	}
+)
+
+// parent 的所有衍生文件, 例如缩略图, 转码, 不包含已删除的
+func Derivatives(ctx context.Context, parent bson.ObjectId) (storages []*Storage, err error) {
+	storages = []*Storage{}
+	err = ModelStorage.Query(ctx).Eq("parent", parent).NeDeleted().Sort("_id").All(&storages)
+	return
+}
+
+// 按层级查询 parent 的所有衍生文件, 每一层使用一次 UpdateAll 软删除
+func deleteDerivatives(ctx context.Context, cache Cache, parent bson.ObjectId) (err error) {
+	var deleted int
+	defer func() {
+		if err != nil {
+			wrapped := wrapError(ErrStorageCascadeDelete, err)
+			wrapped.GinError.Params = map[string]interface{}{"parent": parent, "deleted": deleted}
+			err = wrapped
+		}
+	}()
+	parents := []bson.ObjectId{parent}
+	seen := map[bson.ObjectId]bool{parent: true}
+	for len(parents) != 0 {
+		var children []*Storage
+		if err = ModelStorage.Query(ctx).In("parent", parents).NeDeleted().All(&children); err != nil {
+			return
+		}
+		ids := make([]bson.ObjectId, 0, len(children))
+		removed := make([]*Storage, 0, len(children))
+		for _, child := range children {
+			if !seen[child.ID] {
+				seen[child.ID] = true
+				ids = append(ids, child.ID)
+				removed = append(removed, child)
+			}
+		}
+		if len(ids) == 0 {
+			return
+		}
+		var n int
+		if n, err = ModelStorage.Query(ctx).In("_id", ids).NeDeleted().DeleteAll(); err != nil {
+			return
+		}
+		deleted += n
+		for _, child := range removed {
+			deleteCache(ctx, cache, child.Unique)
+			emitChange(ctx, ChangeEvent{Unique: child.Unique, Kind: ChangeDelete, Status: child.Status, OldStatus: child.Status, Storage: child})
+			purgeCDN(ctx, child)
+			if err = releaseBlob(ctx, child); err != nil {
+				return
+			}
+		}
+		parents = ids
+	}
+	return
+}
+
+// Parent 新设置或修改时检查是否存在
+func (storage *Storage) checkParent() (err error) {
+	if storage.Parent == "" {
+		return
+	}
+	if old, ok := storage.Old.(*Storage); ok && !storage.IsNew && old.Parent == storage.Parent {
+		return
+	}
+	if storage.Parent == storage.ID {
+		return ErrStorageParentNotFound
+	}
+	ctx := storage.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var n int
+	if n, err = ModelStorage.Query(ctx).ID(storage.Parent).NeDeleted().Limit(1).Count(); err != nil {
+		return
+	}
+	if n == 0 {
+		err = ErrStorageParentNotFound
+	}
+	return
+}
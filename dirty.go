@@ -0,0 +1,96 @@
+package model
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/otamoe/gin-server/errs"
+	mgoModel "github.com/otamoe/mgo-model"
+)
+
+// 开始修改已存在的文档, Old 使用深复制, Meta, Tags 等原地修改时也能被 Update 的 $set 检测到
+func (storage *Storage) edit(ctx context.Context) {
+	storage.New(ctx, ModelStorage, storage, false)
+	storage.Old = storage.snapshot()
+}
+
+// 保存成功后重新深复制 Old, 之后原地修改的字段仍能被检测到
+func (storage *Storage) markClean() {
+	storage.Old = storage.snapshot()
+}
+
+// DirtyFields 返回和 Old 不同的 bson 字段 (按名称排序), 即 Update 会写入 $set 或 $unset 的字段
+func (storage *Storage) DirtyFields() (fields []string) {
+	old, ok := storage.Old.(*Storage)
+	if !ok {
+		return
+	}
+	documentStruct, err := mgoModel.DocumentStructParse(reflect.TypeOf(*storage))
+	if err != nil {
+		return
+	}
+	v1 := reflect.ValueOf(storage).Elem()
+	v2 := reflect.ValueOf(old).Elem()
+	for _, field := range documentStruct {
+		if field.BSON == "" {
+			continue
+		}
+		if !reflect.DeepEqual(v1.Field(field.Index).Interface(), v2.Field(field.Index).Interface()) {
+			fields = append(fields, field.BSON)
+		}
+	}
+	sort.Strings(fields)
+	return
+}
+
+// 深复制 map, slice, 错误和时间指针
+func (storage *Storage) snapshot() *Storage {
+	val := storage.clone()
+	val.Meta, _ = copyValue(storage.Meta).(map[string]interface{})
+	val.Variants = append([]Variant(nil), storage.Variants...)
+	val.Subtitles = append([]Track(nil), storage.Subtitles...)
+	val.AudioTracks = append([]Track(nil), storage.AudioTracks...)
+	val.Tags = append([]string(nil), storage.Tags...)
+	val.Errors = append([]*errs.Error(nil), storage.Errors...)
+	val.Warnings = append([]*errs.Error(nil), storage.Warnings...)
+	for _, errors := range [][]*errs.Error{val.Errors, val.Warnings} {
+		for i, e := range errors {
+			if e != nil {
+				errors[i] = e.Clone()
+			}
+		}
+	}
+	for _, v := range []**time.Time{&val.CreatedAt, &val.UpdatedAt, &val.DeletedAt, &val.ExpiresAt} {
+		if *v != nil {
+			t := **v
+			*v = &t
+		}
+	}
+	return val
+}
+
+func copyValue(val interface{}) interface{} {
+	switch val := val.(type) {
+	case map[string]interface{}:
+		if val == nil {
+			return val
+		}
+		m := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			m[k] = copyValue(v)
+		}
+		return m
+	case []interface{}:
+		if val == nil {
+			return val
+		}
+		s := make([]interface{}, len(val))
+		for i, v := range val {
+			s[i] = copyValue(v)
+		}
+		return s
+	}
+	return val
+}
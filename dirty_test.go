@@ -0,0 +1,39 @@
+package model
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDirtyFields(t *testing.T) {
+	now := time.Now()
+	storage := &Storage{
+		Unique:    "a/b.jpg",
+		Name:      "b.jpg",
+		Meta:      map[string]interface{}{"width": 100, "exif": map[string]interface{}{"iso": 200}},
+		Tags:      []string{"a"},
+		CreatedAt: &now,
+	}
+	storage.edit(context.Background())
+	if fields := storage.DirtyFields(); len(fields) != 0 {
+		t.Fatalf("DirtyFields() = %v, want none", fields)
+	}
+
+	storage.Name = "c.jpg"
+	storage.Meta["exif"].(map[string]interface{})["iso"] = 400
+	if fields, want := storage.DirtyFields(), []string{"meta", "name"}; !reflect.DeepEqual(fields, want) {
+		t.Fatalf("DirtyFields() = %v, want %v", fields, want)
+	}
+
+	storage.markClean()
+	if fields := storage.DirtyFields(); len(fields) != 0 {
+		t.Fatalf("DirtyFields() after save = %v, want none", fields)
+	}
+
+	storage.Tags[0] = "b"
+	if fields, want := storage.DirtyFields(), []string{"tags"}; !reflect.DeepEqual(fields, want) {
+		t.Fatalf("DirtyFields() = %v, want %v", fields, want)
+	}
+}
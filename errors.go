@@ -0,0 +1,123 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/otamoe/gin-server/errs"
+)
+
+type (
+	// 源站请求的错误, errors.Is 可以匹配 sentinel 错误和原始错误, errors.As 可以取得 *errs.Error
+	Error struct {
+		GinError *errs.Error
+		err      error
+	}
+)
+
+var (
+	ErrStorageTimeout = &errs.Error{
+		Message:    "Storage: Timeout",
+		Path:       "storage",
+		Type:       "timeout",
+		StatusCode: http.StatusGatewayTimeout,
+	}
+
+	// 调用方取消, 和 nginx 一样使用 499
+	ErrStorageCanceled = &errs.Error{
+		Message:    "Storage: Canceled",
+		Path:       "storage",
+		Type:       "canceled",
+		StatusCode: 499,
+	}
+
+	ErrStorageServerError = &errs.Error{
+		Message:    "Storage: Server error",
+		Path:       "storage",
+		Type:       "server_error",
+		StatusCode: http.StatusBadGateway,
+	}
+
+	ErrStorageUnauthorized = &errs.Error{
+		Message:    "Storage: Unauthorized",
+		Path:       "storage",
+		Type:       "unauthorized",
+		StatusCode: http.StatusUnauthorized,
+	}
+)
+
+// 复制 sentinel 的信息, cause 不为空时同时包装 cause
+func wrapError(sentinel *errs.Error, cause error) *Error {
+	err := &Error{
+		GinError: sentinel.Clone(),
+		err:      sentinel,
+	}
+	if cause != nil {
+		err.err = fmt.Errorf("%w: %w", sentinel, cause)
+	}
+	return err
+}
+
+// 源站的错误状态码转换为 sentinel 错误, 原始状态码都记录在 Params 的 origin_status_code
+// 5xx ErrStorageServerError, 429 ErrStorageRateLimited, 401, 403 ErrStorageUnauthorized, 其他返回 nil
+func originStatusError(res *http.Response) error {
+	var wrapped *Error
+	params := map[string]interface{}{"origin_status_code": res.StatusCode}
+	switch {
+	case res.StatusCode >= 500:
+		wrapped = wrapError(ErrStorageServerError, fmt.Errorf("status code %d", res.StatusCode))
+	case res.StatusCode == http.StatusTooManyRequests:
+		wrapped = wrapError(ErrStorageRateLimited, nil)
+		params["retry_after"] = int64(parseRetryAfter(res.Header.Get("Retry-After")) / time.Second)
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		wrapped = wrapError(ErrStorageUnauthorized, nil)
+	default:
+		return nil
+	}
+	wrapped.GinError.Params = params
+	return wrapped
+}
+
+// ctx 取消或超时的时候包装为 ErrStorageCanceled, ErrStorageTimeout, 不会被当作不存在缓存
+func contextError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return wrapError(ErrStorageCanceled, err)
+	case context.DeadlineExceeded:
+		return wrapError(ErrStorageTimeout, err)
+	}
+	return err
+}
+
+func (err *Error) Error() string {
+	return err.GinError.Error()
+}
+
+func (err *Error) Unwrap() error {
+	return err.err
+}
+
+func (err *Error) As(target interface{}) bool {
+	if ginErr, ok := target.(**errs.Error); ok {
+		*ginErr = err.GinError
+		return true
+	}
+	return false
+}
+
+func (err *Error) MarshalJSON() ([]byte, error) {
+	return err.GinError.MarshalJSON()
+}
+
+// 返回第一个错误, 源站的错误保留 errors.Is 需要的错误链
+func (storage *Storage) Err() error {
+	if storage.err != nil {
+		return storage.err
+	}
+	if len(storage.Errors) != 0 {
+		return storage.Errors[0]
+	}
+	return nil
+}
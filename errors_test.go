@@ -0,0 +1,100 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/otamoe/gin-server/errs"
+)
+
+func TestGetContextError(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		want error
+	}{
+		{
+			name: "cancel",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(20*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			want: ErrStorageCanceled,
+		},
+		{
+			name: "deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			want: ErrStorageTimeout,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, fetcher := newBlockingClient()
+			defer close(fetcher.release)
+			ctx, cancel := test.ctx()
+			defer cancel()
+			_, err := client.Get(ctx, "context/"+test.name+".jpg", false, false)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("Get() = %v (%T), want errors.Is %v", err, err, test.want)
+			}
+		})
+	}
+}
+
+func TestOriginStatusError(t *testing.T) {
+	tests := []struct {
+		status int
+		want   *errs.Error
+	}{
+		{http.StatusOK, nil},
+		{http.StatusNotFound, nil},
+		{http.StatusUnauthorized, ErrStorageUnauthorized},
+		{http.StatusForbidden, ErrStorageUnauthorized},
+		{http.StatusTooManyRequests, ErrStorageRateLimited},
+		{http.StatusInternalServerError, ErrStorageServerError},
+		{http.StatusServiceUnavailable, ErrStorageServerError},
+	}
+	for _, test := range tests {
+		res := &http.Response{StatusCode: test.status, Header: http.Header{"Retry-After": {"3"}}}
+		err := originStatusError(res)
+		if test.want == nil {
+			if err != nil {
+				t.Errorf("%d: err = %v, want nil", test.status, err)
+			}
+			continue
+		}
+		if !errors.Is(err, test.want) {
+			t.Errorf("%d: err = %v, want errors.Is %v", test.status, err, test.want)
+			continue
+		}
+		var ginErr *errs.Error
+		if !errors.As(err, &ginErr) {
+			t.Fatalf("%d: errors.As *errs.Error failed", test.status)
+		}
+		// 状态码保持 sentinel 的值, 源站的状态码记录在 Params
+		if ginErr.StatusCode != test.want.StatusCode || ginErr.Params["origin_status_code"] != test.status {
+			t.Errorf("%d: StatusCode = %d, Params = %v", test.status, ginErr.StatusCode, ginErr.Params)
+		}
+		if test.status == http.StatusTooManyRequests && ginErr.Params["retry_after"] != int64(3) {
+			t.Errorf("retry_after = %v, want 3", ginErr.Params["retry_after"])
+		}
+	}
+}
+
+func TestExistsOriginError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	client := NewClient(WithOrigin(server.URL, server.URL), WithCredentials("user", "pass"))
+	if _, err := client.Exists(context.Background(), "a/b.jpg", false); !errors.Is(err, ErrStorageServerError) {
+		t.Fatalf("Exists() = %v, want ErrStorageServerError", err)
+	}
+}
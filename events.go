@@ -0,0 +1,62 @@
+package model
+
+import (
+	"context"
+	"fmt"
+)
+
+type (
+	ChangeKind string
+
+	ChangeEvent struct {
+		Unique string
+		Kind   ChangeKind
+		// 修改之后的状态, 删除时为删除前的状态
+		Status string
+		// 修改之前的状态, 新文件为空
+		OldStatus string
+		// 修改之后的文档, Complete 修改状态时为 nil
+		Storage *Storage
+	}
+)
+
+const (
+	ChangeSave    ChangeKind = "save"
+	ChangeStatus  ChangeKind = "status"
+	ChangeDelete  ChangeKind = "delete"
+	ChangeRestore ChangeKind = "restore"
+)
+
+// 保存, 修改状态, 删除, 恢复成功之后同步调用, panic 会被记录到日志, 不影响调用方
+// 配置 WebhookURL 时状态修改同时发送 webhook
+var OnChange func(ctx context.Context, event ChangeEvent)
+
+func emitChange(ctx context.Context, event ChangeEvent) {
+	dispatchWebhook(ctx, event)
+	if OnChange == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			Logger.WithField("unique", event.Unique).WithField("kind", event.Kind).WithError(fmt.Errorf("%v", r)).Error("[Storage] on change")
+		}
+	}()
+	OnChange(ctx, event)
+}
+
+// 回源结果只在写入成功的文档时触发, 404 的缓存不触发
+func (storage *Storage) emitSave(ctx context.Context, old *Storage) {
+	if len(storage.Errors) != 0 {
+		return
+	}
+	event := ChangeEvent{
+		Unique:  storage.Unique,
+		Kind:    ChangeSave,
+		Status:  storage.Status,
+		Storage: storage,
+	}
+	if old != nil {
+		event.OldStatus = old.Status
+	}
+	emitChange(ctx, event)
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+func Exists(ctx context.Context, val string, cache bool) (exists bool, err error) {
+	return defaultClient().Exists(ctx, val, cache)
+}
+
+// 缓存未命中时使用 HEAD 请求源站, 不读取元数据
+// 和 Get 一样只返回属于 context 的 CONTEXT_OWNER 的文件, 设置 owner 时 HEAD 无法判断 owner, 回源读取元数据
+func (client *Client) Exists(ctx context.Context, val string, cache bool) (exists bool, err error) {
+	var url string
+	var auth bool
+	if url, auth, err = client.url(val); err != nil {
+		if err == ErrStorageNotFound {
+			err = nil
+		}
+		return
+	}
+	owner := contextOwner(ctx)
+
+	if cache {
+		if cached, ok := client.getCache().Get(ctx, val); ok {
+			if cached.DeletedAt != nil && !includeDeleted(ctx) {
+				return
+			}
+			if !cached.isOwner(owner) {
+				return
+			}
+			if !cached.isNegativeExpired() && !cached.isStale() {
+				exists = !cached.isNegative() && len(cached.Errors) == 0
+				return
+			}
+		}
+	}
+
+	if owner != "" {
+		if _, err = client.GetWithOptions(ctx, val, GetOptions{Owner: owner}); err == nil {
+			exists = true
+		} else if errors.Is(err, ErrStorageNotFound) {
+			err = nil
+		}
+		return
+	}
+
+	var res *http.Response
+	if res, err = client.head(ctx, url, auth, nil); err != nil {
+		return
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		exists = true
+	case http.StatusNotFound:
+	default:
+		err = originStatusError(res)
+	}
+	return
+}
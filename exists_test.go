@@ -0,0 +1,50 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+type mapCache map[string]*Storage
+
+func (cache mapCache) Get(ctx context.Context, unique string) (storage *Storage, ok bool) {
+	storage, ok = cache[unique]
+	return
+}
+
+func (cache mapCache) Set(ctx context.Context, unique string, storage *Storage) {
+	cache[unique] = storage
+}
+
+func TestExistsOwner(t *testing.T) {
+	owner := bson.NewObjectId()
+	now := time.Now()
+	client := NewClient(
+		WithOrigin("http://storage.test", "http://path.test"),
+		WithCache(mapCache{"a/b.jpg": {Unique: "a/b.jpg", Owner: owner, UpdatedAt: &now}}),
+	)
+	tests := []struct {
+		owner bson.ObjectId
+		want  bool
+	}{
+		{"", true},
+		{owner, true},
+		{bson.NewObjectId(), false},
+	}
+	for _, test := range tests {
+		ctx := context.Background()
+		if test.owner != "" {
+			ctx = context.WithValue(ctx, CONTEXT_OWNER, test.owner)
+		}
+		exists, err := client.Exists(ctx, "a/b.jpg", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != test.want {
+			t.Errorf("Exists(owner=%q) = %v, want %v", test.owner, exists, test.want)
+		}
+	}
+}
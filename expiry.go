@@ -0,0 +1,103 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	mgoModel "github.com/otamoe/mgo-model"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// 过期的上传直接删除文档, 默认软删除
+	ExpiryHardDelete bool
+
+	// StartExpiryWorker 的 interval <= 0 时使用
+	DefaultExpiryInterval = time.Hour
+)
+
+// 定时删除 olderThan 之前创建但没有上传完成的 pending 文件, ctx 需要包含 mongo session, ctx 取消时退出
+// interval <= 0 时使用 DefaultExpiryInterval
+func StartExpiryWorker(ctx context.Context, olderThan time.Duration, interval time.Duration) {
+	interval = expiryInterval(interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if n, err := expirePending(ctx, olderThan); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				Logger.WithError(err).Error("[Storage] expire pending")
+			} else {
+				Logger.WithFields(logrus.Fields{
+					"count":      n,
+					"older_than": olderThan,
+				}).Info("[Storage] expire pending")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// 逐个删除, 和 Delete 一样清除缓存, 发送 ChangeDelete, 释放引用计数
+func expirePending(ctx context.Context, olderThan time.Duration) (n int, err error) {
+	before := time.Now().Add(-olderThan)
+	iter := ModelStorage.DB(ctx).Find(expiredQuery(ctx, before).Map()).Iter()
+	storage := &Storage{}
+	for iter.Next(storage) {
+		if e := expireStorage(ctx, storage, before); e == nil {
+			n++
+		} else if e != mgo.ErrNotFound {
+			err = e
+			break
+		}
+		storage = &Storage{}
+	}
+	if e := iter.Close(); err == nil {
+		err = e
+	}
+	return
+}
+
+// 按 _id 重新检查条件, 期间已上传完成的不删除
+func expireStorage(ctx context.Context, storage *Storage, before time.Time) (err error) {
+	query := expiredQuery(ctx, before).ID(storage.ID)
+	if ExpiryHardDelete {
+		err = query.ForceDelete()
+	} else {
+		err = query.Delete()
+	}
+	if err != nil {
+		return
+	}
+	storage.New(ctx, ModelStorage, storage, false)
+	defaultClient().deleteCache(ctx, storage.Unique)
+	emitChange(ctx, ChangeEvent{Unique: storage.Unique, Kind: ChangeDelete, Status: storage.Status, OldStatus: storage.Status, Storage: storage})
+	purgeCDN(ctx, storage)
+	err = releaseBlob(ctx, storage)
+	return
+}
+
+func expiredQuery(ctx context.Context, before time.Time) *mgoModel.Query {
+	return ModelStorage.Query(ctx).
+		Eq("status", StatusPending).
+		Eq("complete", false).
+		Lt("created_at", before).
+		NeDeleted()
+}
+
+func expiryInterval(interval time.Duration) time.Duration {
+	if interval > 0 {
+		return interval
+	}
+	if DefaultExpiryInterval > 0 {
+		return DefaultExpiryInterval
+	}
+	return time.Hour
+}
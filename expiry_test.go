@@ -0,0 +1,31 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiryInterval(t *testing.T) {
+	defer func(val time.Duration) { DefaultExpiryInterval = val }(DefaultExpiryInterval)
+	DefaultExpiryInterval = 10 * time.Minute
+	tests := []struct {
+		interval time.Duration
+		want     time.Duration
+	}{
+		{time.Second, time.Second},
+		{0, 10 * time.Minute},
+		{-time.Second, 10 * time.Minute},
+	}
+	for _, test := range tests {
+		if got := expiryInterval(test.interval); got != test.want {
+			t.Errorf("expiryInterval(%v) = %v, want %v", test.interval, got, test.want)
+		}
+		// 不会 panic
+		time.NewTicker(expiryInterval(test.interval)).Stop()
+	}
+
+	DefaultExpiryInterval = 0
+	if got := expiryInterval(0); got <= 0 {
+		t.Errorf("expiryInterval(0) = %v with DefaultExpiryInterval 0", got)
+	}
+}
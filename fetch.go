@@ -0,0 +1,405 @@
+package model
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/otamoe/gin-server/errs"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 按顺序请求 urls, 网络错误或 5xx 时转移到下一个源站, 全部失败后按 maxRetries 重试
+func (client *Client) fetch(ctx context.Context, urls []string, auth bool, etag string) (storage *Storage) {
+
+	var err error
+	storage = &Storage{}
+
+	var span trace.Span
+	ctx, span = tracer.Start(ctx, "storage.fetch", trace.WithAttributes(
+		attribute.String("http.url", urls[0]),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	defer func() {
+		if err != nil {
+			storage.addError(err)
+		}
+	}()
+	// 继承调用方的 ctx, 调用方 deadline 更短时以调用方为准
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, client.fetchTimeout(ctx))
+	defer timeoutCancel()
+
+	var retry bool
+	var retryAfter time.Duration
+	for i := 0; ; i++ {
+		for _, url := range urls {
+			if retry, retryAfter, err = client.fetchDo(timeoutCtx, url, auth, etag, storage); err == nil || !retry || timeoutCtx.Err() != nil {
+				return
+			}
+		}
+		if i >= client.maxRetries {
+			return
+		}
+		delay := client.fetchBackoff(i)
+		if retryAfter > 0 {
+			delay = retryAfter
+		}
+		// 等待时间超过 deadline 直接返回
+		if deadline, ok := timeoutCtx.Deadline(); ok && time.Until(deadline) < delay {
+			return
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timeoutCtx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (client *Client) fetchDo(ctx context.Context, url string, auth bool, etag string, storage *Storage) (retry bool, retryAfter time.Duration, err error) {
+	var res *http.Response
+	var bodyBytes []byte
+
+	atomic.AddInt64(&stats.OriginFetches, 1)
+	var statusCode int
+	start := time.Now()
+	defer func() {
+		DefaultMetrics.ObserveFetch(time.Since(start), statusCode, err)
+	}()
+
+	var req *http.Request
+	if req, err = http.NewRequest("GET", url, nil); err != nil {
+		err = ErrStorageNotFound
+		return
+	}
+	client.setHeaders(ctx, req)
+	if auth {
+		if err = client.setAuth(req); err != nil {
+			return
+		}
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	// 手动设置后 Transport 不会自动解压, 由 decodeBody 处理
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	req = req.WithContext(ctx)
+
+	var release func()
+	if release, err = acquireFetch(ctx); err != nil {
+		return
+	}
+	defer release()
+
+	key := breakerKey(url)
+	if !breakers.allow(key) {
+		err = ErrStorageCircuitOpen
+		retry = true
+		return
+	}
+	breakerResult := breakerNone
+	defer func() {
+		breakers.done(key, breakerResult)
+	}()
+
+	if res, err = client.getHTTPClient().Do(req); err != nil {
+		if retry = ctx.Err() == nil; retry {
+			breakerResult = breakerFailure
+		} else {
+			err = contextError(ctx, err)
+		}
+		return
+	}
+	defer res.Body.Close()
+	statusCode = res.StatusCode
+	// 多次尝试时记录最后一次的状态码, 没有响应时不记录
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+	maxBytes := client.maxResponseBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxResponseBytes
+	}
+	var body io.ReadCloser
+	if body, err = decodeBody(res); err != nil {
+		breakerResult = breakerSuccess
+		return
+	}
+	defer body.Close()
+	// 限制解压后的大小
+	if bodyBytes, err = ioutil.ReadAll(io.LimitReader(body, maxBytes+1)); err != nil {
+		if retry = ctx.Err() == nil; retry {
+			breakerResult = breakerFailure
+		} else {
+			err = contextError(ctx, err)
+		}
+		return
+	}
+	if res.StatusCode >= 500 {
+		breakerResult = breakerFailure
+	} else {
+		breakerResult = breakerSuccess
+	}
+	if int64(len(bodyBytes)) > maxBytes {
+		err = ErrStorageResponseTooLarge
+		return
+	}
+
+	Logger.WithFields(logrus.Fields{
+		"url":      url,
+		"status":   res.StatusCode,
+		"duration": time.Since(start),
+		"body":     redactBody(bodyBytes),
+	}).Debug("[Storage] fetch")
+
+	if err = originStatusError(res); err != nil {
+		retry = res.StatusCode != http.StatusUnauthorized && res.StatusCode != http.StatusForbidden
+		if res.StatusCode == http.StatusTooManyRequests {
+			retryAfter = parseRetryAfter(res.Header.Get("Retry-After"))
+		}
+		return
+	}
+	if res.StatusCode == http.StatusNotModified && etag != "" {
+		storage.StatusCode = res.StatusCode
+		storage.ExpiresAt = parseCacheControl(res.Header.Get("Cache-Control"))
+		return
+	}
+	if res.StatusCode > 200 {
+		err = ErrStorageNotFound
+		return
+	}
+
+	if err = json.Unmarshal(bodyBytes, storage); err != nil {
+		return
+	}
+	storage.setContentType(res.Header.Get("Content-Type"))
+	if val := res.Header.Get("ETag"); val != "" {
+		storage.ETag = val
+	}
+	storage.ExpiresAt = parseCacheControl(res.Header.Get("Cache-Control"))
+	return
+}
+
+// max-age 计算过期时间, no-cache, no-store 立即过期, 没有时返回 nil
+func parseCacheControl(val string) (expiresAt *time.Time) {
+	for _, directive := range strings.Split(val, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		var maxAge int64
+		switch {
+		case directive == "no-cache" || directive == "no-store":
+		case strings.HasPrefix(directive, "max-age="):
+			var err error
+			if maxAge, err = strconv.ParseInt(strings.Trim(directive[len("max-age="):], `"`), 10, 64); err != nil || maxAge < 0 {
+				continue
+			}
+			// 防止 Duration 溢出
+			if maxAge > int64(math.MaxInt64/time.Second) {
+				maxAge = int64(math.MaxInt64 / time.Second)
+			}
+		default:
+			continue
+		}
+		t := time.Now().Add(time.Duration(maxAge) * time.Second).UTC()
+		if expiresAt == nil || t.Before(*expiresAt) {
+			expiresAt = &t
+		}
+	}
+	return
+}
+
+// 按 Content-Encoding 解压, deflate 是 zlib 格式
+func decodeBody(res *http.Response) (body io.ReadCloser, err error) {
+	switch strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		body, err = gzip.NewReader(res.Body)
+	case "deflate":
+		body, err = zlib.NewReader(res.Body)
+	default:
+		body = ioutil.NopCloser(res.Body)
+	}
+	// 304, 404 等空响应
+	if err == io.EOF {
+		body = ioutil.NopCloser(strings.NewReader(""))
+		err = nil
+	}
+	return
+}
+
+// 源站没有返回 type, sub_type 时从 Content-Type 补全
+func (storage *Storage) setContentType(contentType string) {
+	if storage.Type != "" && storage.SubType != "" {
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "application/json" {
+		return
+	}
+	types := strings.SplitN(mediaType, "/", 2)
+	if len(types) != 2 || types[0] == "" || types[1] == "" {
+		return
+	}
+	if storage.Type == "" {
+		storage.Type = types[0]
+	}
+	if storage.SubType == "" {
+		storage.SubType = types[1]
+	}
+}
+
+// Fetch 实现 Fetcher, Storage.Errors 不为空时返回第一个错误
+func (client *Client) Fetch(ctx context.Context, url string, auth bool) (storage *Storage, err error) {
+	storage = client.fetch(ctx, []string{url}, auth, "")
+	err = storage.Err()
+	return
+}
+
+func (storage *Storage) addError(err error) {
+	if storage.err == nil {
+		storage.err = err
+	}
+	ginErr := toError(err)
+	storage.Errors = append(storage.Errors, ginErr)
+	if storage.StatusCode != 0 {
+
+	} else if ginErr.StatusCode != 0 {
+		storage.StatusCode = ginErr.StatusCode
+	} else {
+		storage.StatusCode = http.StatusInternalServerError
+	}
+}
+
+// Storage.Errors 会写入数据库, 不保存 Err, 原始的错误链保存在 storage.err
+func toError(err error) (ginErr *errs.Error) {
+	switch err.(type) {
+	case *Error:
+		ginErr = err.(*Error).GinError
+	case *errs.Error:
+		ginErr = err.(*errs.Error)
+		if ginErr.Err != nil {
+			// 复制一份, 不修改 sentinel 错误
+			ginErr = ginErr.Clone()
+			if ginErr.Message == "" {
+				ginErr.Message = ginErr.Err.Error()
+			}
+			ginErr.Err = nil
+		}
+	default:
+		ginErr = &errs.Error{
+			Message: err.Error(),
+		}
+	}
+	return
+}
+
+// BearerToken 优先于 Username/Password
+func (client *Client) setAuth(req *http.Request) (err error) {
+	if client.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+client.bearerToken)
+		return
+	}
+	if client.username == "" {
+		err = errors.New("storage-model.Username is required")
+		return
+	}
+	if client.password == "" {
+		err = errors.New("storage-model.Password is required")
+		return
+	}
+	req.SetBasicAuth(client.username, client.password)
+	return
+}
+
+// Retry-After 支持秒数和 HTTP-date
+func parseRetryAfter(val string) (delay time.Duration) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return
+	}
+	if seconds, err := strconv.ParseInt(val, 10, 64); err == nil {
+		if seconds > 0 {
+			delay = time.Duration(seconds) * time.Second
+		}
+		return
+	}
+	if date, err := http.ParseTime(val); err == nil {
+		if delay = time.Until(date); delay < 0 {
+			delay = 0
+		}
+	}
+	return
+}
+
+// 指数退避 + 随机抖动 [delay/2, delay)
+func (client *Client) fetchBackoff(i int) (delay time.Duration) {
+	delay = client.retryBaseDelay
+	if delay <= 0 {
+		delay = DefaultFetchRetryBaseDelay
+	}
+	if i > 16 {
+		i = 16
+	}
+	delay = delay << uint(i)
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	return
+}
+
+func (client *Client) head(ctx context.Context, url string, auth bool, header http.Header) (res *http.Response, err error) {
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, client.fetchTimeout(ctx))
+	defer timeoutCancel()
+
+	var req *http.Request
+	if req, err = http.NewRequest("HEAD", url, nil); err != nil {
+		err = ErrStorageNotFound
+		return
+	}
+	client.setHeaders(ctx, req)
+	for key, vals := range header {
+		req.Header[key] = vals
+	}
+	if auth {
+		if err = client.setAuth(req); err != nil {
+			return
+		}
+	}
+	req = req.WithContext(timeoutCtx)
+
+	var release func()
+	if release, err = acquireFetch(timeoutCtx); err != nil {
+		err = contextError(timeoutCtx, err)
+		return
+	}
+	defer release()
+
+	atomic.AddInt64(&stats.OriginFetches, 1)
+	start := time.Now()
+	if res, err = client.getHTTPClient().Do(req); err != nil {
+		DefaultMetrics.ObserveFetch(time.Since(start), 0, err)
+		err = contextError(timeoutCtx, err)
+		return
+	}
+	res.Body.Close()
+	DefaultMetrics.ObserveFetch(time.Since(start), res.StatusCode, nil)
+	return
+}
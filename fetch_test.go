@@ -0,0 +1,99 @@
+package model
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchDecodeBody(t *testing.T) {
+	const doc = `{"path":"a.jpg","status":"approved","name":"a"}`
+	gzipBody := func(data string) []byte {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(data))
+		w.Close()
+		return buf.Bytes()
+	}
+	deflateBody := func(data string) []byte {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write([]byte(data))
+		w.Close()
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		maxBytes int64
+		wantName string
+		wantErr  error
+	}{
+		{name: "identity", body: []byte(doc), wantName: "a"},
+		{name: "gzip", encoding: "gzip", body: gzipBody(doc), wantName: "a"},
+		{name: "x-gzip", encoding: "x-gzip", body: gzipBody(doc), wantName: "a"},
+		{name: "deflate", encoding: "deflate", body: deflateBody(doc), wantName: "a"},
+		{name: "malformed gzip", encoding: "gzip", body: []byte("not gzip data")},
+		{name: "truncated gzip", encoding: "gzip", body: gzipBody(doc)[:20]},
+		{name: "malformed json", body: []byte(`{"path":`)},
+		{name: "too large", body: []byte(doc), maxBytes: 10, wantErr: ErrStorageResponseTooLarge},
+		// 解压之后的大小
+		{name: "too large gzip", encoding: "gzip", body: gzipBody(`{"name":"` + strings.Repeat("a", 4096) + `"}`), maxBytes: 1024, wantErr: ErrStorageResponseTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.encoding != "" {
+					w.Header().Set("Content-Encoding", test.encoding)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write(test.body)
+			}))
+			defer server.Close()
+
+			opts := []Option{WithOrigin(server.URL, server.URL)}
+			if test.maxBytes != 0 {
+				opts = append(opts, WithMaxResponseBytes(test.maxBytes))
+			}
+			client := NewClient(opts...)
+			storage, err := client.Fetch(context.Background(), server.URL+"/a", false)
+			if test.wantName != "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if storage.Name != test.wantName {
+					t.Fatalf("Name = %q, want %q", storage.Name, test.wantName)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Fatalf("err = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// 304, 404 等空响应的 gzip 不是错误
+func TestDecodeBodyEmpty(t *testing.T) {
+	res := httptest.NewRecorder()
+	res.Header().Set("Content-Encoding", "gzip")
+	body, err := decodeBody(res.Result())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	var buf bytes.Buffer
+	if n, _ := buf.ReadFrom(body); n != 0 {
+		t.Fatalf("read %d bytes", n)
+	}
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"context"
+)
+
+type (
+	// Fetcher 获取源站的元数据, 返回的 error 会记录到 Storage.Errors
+	Fetcher interface {
+		Fetch(ctx context.Context, url string, auth bool) (storage *Storage, err error)
+	}
+)
+
+var (
+	// 替换默认的 http 实现, nil 时使用 http
+	DefaultFetcher Fetcher
+
+	_ Fetcher = (*Client)(nil)
+)
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type (
+	// FileFetcher 从本地目录读取元数据, 用于开发和测试
+	// 文件路径为 Dir/<url path>.json, 源站配置为不带路径的地址 (例如 http://local) 时即为 Dir/<unique>.json
+	FileFetcher struct {
+		Dir string
+	}
+)
+
+var _ Fetcher = (*FileFetcher)(nil)
+
+func (fetcher *FileFetcher) Fetch(ctx context.Context, rawurl string, auth bool) (storage *Storage, err error) {
+	storage = &Storage{}
+	if err = ctx.Err(); err != nil {
+		err = contextError(ctx, err)
+		return
+	}
+
+	var u *url.URL
+	if u, err = url.Parse(rawurl); err != nil {
+		err = ErrStorageNotFound
+		return
+	}
+	name := strings.Trim(u.Path, "/")
+	if name == "" {
+		err = ErrStorageNotFound
+		return
+	}
+	dir := filepath.Clean(fetcher.Dir)
+	file := filepath.Join(dir, filepath.FromSlash(name)+".json")
+	if !strings.HasPrefix(file, dir+string(filepath.Separator)) {
+		err = ErrStorageNotFound
+		return
+	}
+
+	var data []byte
+	if data, err = ioutil.ReadFile(file); err != nil {
+		if os.IsNotExist(err) {
+			err = ErrStorageNotFound
+		}
+		return
+	}
+	err = json.Unmarshal(data, storage)
+	return
+}
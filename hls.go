@@ -0,0 +1,162 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/otamoe/gin-server/errs"
+)
+
+var (
+	// 回源后读取 HLS 播放列表, 分片数量和总时长写入 Meta 的 hls_segments, hls_duration
+	// 需要额外请求一次源站, 默认关闭
+	ParseHLS bool
+
+	ErrStorageHLSInvalid = &errs.Error{
+		Message:    "Storage: Invalid HLS playlist",
+		Path:       "hls",
+		Type:       "invalid",
+		StatusCode: http.StatusBadGateway,
+	}
+)
+
+// HLS AES-128 密钥的字节数
+const HLSKeySize = 16
+
+// 生成随机的 HLS AES-128 密钥, 格式为 32 个小写十六进制字符, 播放器使用 hex 解码后的 16 字节
+func GenerateHLSKey() (key string, err error) {
+	b := make([]byte, HLSKeySize)
+	if _, err = io.ReadFull(rand.Reader, b); err != nil {
+		return
+	}
+	key = hex.EncodeToString(b)
+	return
+}
+
+// 读取并解析 storage.HLS, 主播放列表只记录 hls_variants
+func (client *Client) parseHLS(ctx context.Context, storage *Storage) (err error) {
+	var data []byte
+	if data, err = client.fetchManifest(ctx, storage, storage.HLS); err != nil {
+		return
+	}
+
+	var segments, variants int
+	var duration float64
+	if segments, variants, duration, err = parsePlaylist(data); err != nil {
+		return
+	}
+	if storage.Meta == nil {
+		storage.Meta = map[string]interface{}{}
+	}
+	if variants != 0 {
+		storage.Meta["hls_variants"] = variants
+	} else {
+		storage.Meta["hls_segments"] = segments
+		storage.Meta["hls_duration"] = duration
+	}
+	return
+}
+
+// 读取 HLS, DASH 等清单文件
+func (client *Client) fetchManifest(ctx context.Context, storage *Storage, path string) (data []byte, err error) {
+	var url string
+	var auth bool
+	if url, auth, err = client.pathURL(storage, path); err != nil {
+		return
+	}
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, client.fetchTimeout(ctx))
+	defer timeoutCancel()
+
+	var req *http.Request
+	if req, err = http.NewRequest("GET", url, nil); err != nil {
+		return
+	}
+	client.setHeaders(ctx, req)
+	if auth {
+		if err = client.setAuth(req); err != nil {
+			return
+		}
+	}
+
+	var release func()
+	if release, err = acquireFetch(timeoutCtx); err != nil {
+		err = contextError(timeoutCtx, err)
+		return
+	}
+	defer release()
+
+	var res *http.Response
+	if res, err = client.getHTTPClient().Do(req.WithContext(timeoutCtx)); err != nil {
+		err = contextError(timeoutCtx, err)
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		err = statusError(res.StatusCode)
+		return
+	}
+	maxBytes := client.maxResponseBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxResponseBytes
+	}
+	if data, err = ioutil.ReadAll(io.LimitReader(res.Body, maxBytes+1)); err != nil {
+		err = contextError(timeoutCtx, err)
+		return
+	}
+	if int64(len(data)) > maxBytes {
+		err = ErrStorageResponseTooLarge
+	}
+	return
+}
+
+func parsePlaylist(data []byte) (segments, variants int, duration float64, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	first := true
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if first {
+			if strings.TrimPrefix(line, "\ufeff") != "#EXTM3U" {
+				err = ErrStorageHLSInvalid
+				return
+			}
+			first = false
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			variants++
+		case strings.HasPrefix(line, "#EXTINF:"):
+			val := strings.TrimPrefix(line, "#EXTINF:")
+			if index := strings.Index(val, ","); index != -1 {
+				val = val[:index]
+			}
+			var d float64
+			if d, err = strconv.ParseFloat(strings.TrimSpace(val), 64); err != nil || d < 0 {
+				wrapped := wrapError(ErrStorageHLSInvalid, err)
+				wrapped.GinError.Value = line
+				err = wrapped
+				return
+			}
+			segments++
+			duration += d
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if first || (segments == 0 && variants == 0) {
+		err = ErrStorageHLSInvalid
+	}
+	return
+}
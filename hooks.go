@@ -0,0 +1,173 @@
+package model
+
+import (
+	"math"
+	"time"
+
+	mgoModel "github.com/otamoe/mgo-model"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// 和 Storage.Pixels 的 binding max 一致
+	MaxPixels int64 = 268435456
+
+	// Pixels 和 Width * Height 允许的相对误差
+	PixelsTolerance = 0.01
+
+	// 和 Storage.Width, Storage.Height 的 binding max 一致
+	MaxDimension = 32767
+
+	// 为 true 时回源的 Width, Height, Pixels 超过最大值时修改为最大值, 默认由 binding 拒绝
+	ClampDimensions bool
+
+	// 回源的 Duration 保留的小数位数, 小于 0 时不处理
+	DurationPrecision = 3
+)
+
+func init() {
+	ModelStorage.OnEvent("save", onStorageSave)
+	ModelStorage.OnEvent("insert", onStorageInsert)
+	ModelStorage.OnEvent("update", onStorageUpdate)
+}
+
+func onStorageSave(document mgoModel.DocumentInterface, next mgoModel.ModelEventNext) (err error) {
+	storage, ok := document.(*Storage)
+	if !ok {
+		return
+	}
+	storage.normalizeTimes()
+	storage.normalizePixels()
+	if err = storage.limitMeta(); err != nil {
+		return
+	}
+	if err = storage.limitTags(); err != nil {
+		return
+	}
+	if err = storage.checkTracks(); err != nil {
+		return
+	}
+	err = storage.checkParent()
+	return
+}
+
+// 回源结果和 save 事件相同的规范化, 在 Changed 和已储存的文档比较之前执行
+func (storage *Storage) normalize() (err error) {
+	storage.defaultStatus()
+	storage.clampDimensions()
+	storage.roundDuration()
+	storage.normalizePixels()
+	if err = storage.limitMeta(); err != nil {
+		return
+	}
+	err = storage.limitTags()
+	return
+}
+
+// Pixels 为 0 时由 Width * Height 计算, 已有值时和计算结果差距超过 PixelsTolerance 记录警告
+func (storage *Storage) normalizePixels() {
+	if storage.Width <= 0 || storage.Height <= 0 {
+		return
+	}
+	pixels := int64(storage.Width) * int64(storage.Height)
+	if pixels > MaxPixels {
+		pixels = MaxPixels
+	}
+	if storage.Pixels == 0 {
+		storage.Pixels = int(pixels)
+		return
+	}
+	if diff := math.Abs(float64(int64(storage.Pixels)-pixels)) / float64(pixels); diff > PixelsTolerance {
+		Logger.WithFields(logrus.Fields{
+			"unique": storage.Unique,
+			"width":  storage.Width,
+			"height": storage.Height,
+			"pixels": storage.Pixels,
+		}).Warn("[Storage] pixels does not match width * height")
+	}
+}
+
+// ClampDimensions 时把超过最大值的尺寸修改为最大值
+func (storage *Storage) clampDimensions() {
+	if !ClampDimensions {
+		return
+	}
+	fields := logrus.Fields{}
+	if storage.Width > MaxDimension {
+		fields["width"] = storage.Width
+		storage.Width = MaxDimension
+	}
+	if storage.Height > MaxDimension {
+		fields["height"] = storage.Height
+		storage.Height = MaxDimension
+	}
+	if int64(storage.Pixels) > MaxPixels {
+		fields["pixels"] = storage.Pixels
+		storage.Pixels = int(MaxPixels)
+	}
+	if len(fields) != 0 {
+		fields["unique"] = storage.Unique
+		Logger.WithFields(fields).Warn("[Storage] clamp dimensions")
+	}
+}
+
+func (storage *Storage) roundDuration() {
+	if DurationPrecision < 0 || storage.Duration == 0 {
+		return
+	}
+	pow := math.Pow10(DurationPrecision)
+	if val := math.Round(storage.Duration*pow) / pow; !math.IsInf(val, 0) && !math.IsNaN(val) {
+		storage.Duration = val
+	}
+}
+
+// 所有时间统一储存为 UTC, 截断为 mongodb 储存的毫秒精度
+func (storage *Storage) normalizeTimes() {
+	for _, val := range []**time.Time{&storage.CreatedAt, &storage.UpdatedAt, &storage.DeletedAt, &storage.ExpiresAt} {
+		if *val != nil {
+			utc := (*val).UTC().Truncate(time.Millisecond)
+			*val = &utc
+		}
+	}
+}
+
+// 插入时补全源站没有提供的 CreatedAt, UpdatedAt
+func onStorageInsert(document mgoModel.DocumentInterface, next mgoModel.ModelEventNext) (err error) {
+	storage, ok := document.(*Storage)
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	if storage.CreatedAt == nil {
+		storage.CreatedAt = &now
+	}
+	if storage.UpdatedAt == nil {
+		storage.UpdatedAt = &now
+	}
+	if storage.Version == 0 {
+		storage.Version = 1
+	}
+	if err = storage.checkQuota(); err != nil {
+		return
+	}
+	err = storage.dedup()
+	return
+}
+
+// 更新时保留原来的 CreatedAt, 每次写入刷新 UpdatedAt
+func onStorageUpdate(document mgoModel.DocumentInterface, next mgoModel.ModelEventNext) (err error) {
+	storage, ok := document.(*Storage)
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	if storage.CreatedAt == nil {
+		if old, ok := storage.Old.(*Storage); ok && old.CreatedAt != nil {
+			storage.CreatedAt = old.CreatedAt
+		} else {
+			storage.CreatedAt = &now
+		}
+	}
+	storage.UpdatedAt = &now
+	return
+}
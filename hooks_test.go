@@ -0,0 +1,70 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeTimes(t *testing.T) {
+	shanghai := time.FixedZone("UTC+8", 8*60*60)
+	created := time.Date(2020, 1, 2, 8, 4, 5, 123456789, shanghai)
+	updated := time.Date(2020, 1, 2, 0, 4, 5, 999999999, time.UTC)
+	storage := &Storage{
+		CreatedAt: &created,
+		UpdatedAt: &updated,
+	}
+	storage.normalizeTimes()
+
+	if storage.DeletedAt != nil || storage.ExpiresAt != nil {
+		t.Fatalf("nil times should stay nil: %v %v", storage.DeletedAt, storage.ExpiresAt)
+	}
+	tests := []struct {
+		name string
+		got  *time.Time
+		want time.Time
+	}{
+		{"created_at", storage.CreatedAt, time.Date(2020, 1, 2, 0, 4, 5, 123000000, time.UTC)},
+		{"updated_at", storage.UpdatedAt, time.Date(2020, 1, 2, 0, 4, 5, 999000000, time.UTC)},
+	}
+	for _, test := range tests {
+		if test.got.Location() != time.UTC {
+			t.Errorf("%s location = %v, want UTC", test.name, test.got.Location())
+		}
+		if !test.got.Equal(test.want) || test.got.Nanosecond() != test.want.Nanosecond() {
+			t.Errorf("%s = %v, want %v", test.name, test.got, test.want)
+		}
+	}
+	// 不修改调用方的时间
+	if created.Location() != shanghai || created.Nanosecond() != 123456789 {
+		t.Errorf("input time modified: %v", created)
+	}
+}
+
+func TestNormalizeUnchanged(t *testing.T) {
+	// 已储存的文档经过 save 事件规范化
+	stored := &Storage{
+		Unique: "a/b.jpg",
+		Status: StatusApproved,
+		Width:  100,
+		Height: 50,
+		Pixels: 5000,
+		Tags:   []string{"a", "b"},
+	}
+	// 源站没有返回 pixels, tags 有空白和重复
+	fetched := &Storage{
+		Unique: "a/b.jpg",
+		Status: StatusApproved,
+		Width:  100,
+		Height: 50,
+		Tags:   []string{" a", "b", "a"},
+	}
+	if !Changed(fetched, stored) {
+		t.Fatal("Changed() before normalize = false, want true")
+	}
+	if err := fetched.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if Changed(fetched, stored) {
+		t.Fatalf("Changed() after normalize = true: %+v", fetched)
+	}
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	fetchSemaphore struct {
+		mu   sync.Mutex
+		ch   chan struct{}
+		size int
+	}
+)
+
+var fetchSem = &fetchSemaphore{}
+
+// MaxConcurrentFetches <= 0 时不限制
+func acquireFetch(ctx context.Context) (release func(), err error) {
+	ch := fetchSem.get(MaxConcurrentFetches)
+	if ch != nil {
+		select {
+		case ch <- struct{}{}:
+		case <-ctx.Done():
+			err = contextError(ctx, ctx.Err())
+			return
+		}
+	}
+	atomic.AddInt64(&stats.InFlightFetches, 1)
+	release = func() {
+		atomic.AddInt64(&stats.InFlightFetches, -1)
+		if ch != nil {
+			<-ch
+		}
+	}
+	return
+}
+
+func (sem *fetchSemaphore) get(size int) chan struct{} {
+	if size <= 0 {
+		return nil
+	}
+	sem.mu.Lock()
+	defer sem.mu.Unlock()
+	if sem.size != size {
+		sem.ch = make(chan struct{}, size)
+		sem.size = size
+	}
+	return sem.ch
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	mgoModel "github.com/otamoe/mgo-model"
+)
+
+type (
+	CountFilter struct {
+		Owner  bson.ObjectId
+		Status string
+		Type   string
+
+		// 包含 Tags 中任意一个标签, TagsAll 为 true 时需要包含全部
+		Tags    []string
+		TagsAll bool
+
+		// created_at 范围 [CreatedAfter, CreatedBefore)
+		CreatedAfter  *time.Time
+		CreatedBefore *time.Time
+
+		IncludeDeleted bool
+	}
+
+	ListOptions struct {
+		CountFilter
+
+		// 分页游标 上一页最后一个 _id, 结果按 _id 倒序
+		Cursor bson.ObjectId
+		Limit  int
+	}
+)
+
+var (
+	DefaultListLimit = 20
+	MaxListLimit     = 1000
+)
+
+func List(ctx context.Context, opts ListOptions) (storages []*Storage, err error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+	query := opts.query(ctx)
+	if opts.Cursor != "" {
+		query.Lt("_id", opts.Cursor)
+	}
+	storages = []*Storage{}
+	err = query.Sort("-_id").Limit(limit).All(&storages)
+	return
+}
+
+func Count(ctx context.Context, filter CountFilter) (n int64, err error) {
+	if err = ctx.Err(); err != nil {
+		err = contextError(ctx, err)
+		return
+	}
+	find := ModelStorage.DB(ctx).Find(filter.query(ctx).Map())
+	if deadline, ok := ctx.Deadline(); ok {
+		find.SetMaxTime(time.Until(deadline))
+	}
+	var count int
+	if count, err = find.Count(); err != nil {
+		return
+	}
+	n = int64(count)
+	return
+}
+
+func (opts CountFilter) query(ctx context.Context) (query *mgoModel.Query) {
+	query = ModelStorage.Query(ctx)
+	if opts.Owner != "" {
+		query.Eq("owner", opts.Owner)
+	}
+	if opts.Status != "" {
+		query.Eq("status", opts.Status)
+	}
+	if opts.Type != "" {
+		query.Eq("type", opts.Type)
+	}
+	if len(opts.Tags) != 0 {
+		if opts.TagsAll {
+			query.Name("tags", "all", opts.Tags)
+		} else {
+			query.In("tags", opts.Tags)
+		}
+	}
+	if opts.CreatedAfter != nil {
+		query.Gte("created_at", *opts.CreatedAfter)
+	}
+	if opts.CreatedBefore != nil {
+		query.Lt("created_at", *opts.CreatedBefore)
+	}
+	if !opts.IncludeDeleted {
+		query.NeDeleted()
+	}
+	return
+}
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mgoModel "github.com/otamoe/mgo-model"
+)
+
+type (
+	// 缓存可以删除单个文档, Delete, Restore, UpdateStatus 等修改之后调用
+	CacheDeleter interface {
+		Delete(ctx context.Context, unique string)
+	}
+
+	// 进程内的 LRU 缓存, 未命中时读取 Next
+	LRUCache struct {
+		Next Cache
+
+		size int
+		ttl  time.Duration
+
+		mu      sync.Mutex
+		entries map[string]*list.Element
+		order   *list.List
+	}
+
+	lruEntry struct {
+		unique    string
+		storage   *Storage
+		expiresAt time.Time
+	}
+)
+
+// size 最大数量, ttl 每个文档的缓存时间, 0 不过期, next 为 nil 时使用 MongoCache
+func NewLRUCache(size int, ttl time.Duration, next Cache) *LRUCache {
+	if next == nil {
+		next = MongoCache{}
+	}
+	return &LRUCache{
+		Next:    next,
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+func (cache *LRUCache) Get(ctx context.Context, unique string) (storage *Storage, ok bool) {
+	if storage, ok = cache.get(unique); ok {
+		atomic.AddInt64(&stats.LRUHits, 1)
+		return
+	}
+	atomic.AddInt64(&stats.LRUMisses, 1)
+	if storage, ok = cache.Next.Get(ctx, unique); ok {
+		cache.set(unique, storage)
+	}
+	return
+}
+
+func (cache *LRUCache) Set(ctx context.Context, unique string, storage *Storage) {
+	cache.set(unique, storage)
+	cache.Next.Set(ctx, unique, storage)
+}
+
+func (cache *LRUCache) Delete(ctx context.Context, unique string) {
+	cache.mu.Lock()
+	if element, ok := cache.entries[unique]; ok {
+		cache.remove(element)
+	}
+	cache.mu.Unlock()
+	if deleter, ok := cache.Next.(CacheDeleter); ok {
+		deleter.Delete(ctx, unique)
+	}
+}
+
+func (cache *LRUCache) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.order.Len()
+}
+
+// 返回深复制的副本, 调用方修改 Meta, Tags 等不影响缓存
+func (cache *LRUCache) get(unique string) (storage *Storage, ok bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	element, ok := cache.entries[unique]
+	if !ok {
+		return
+	}
+	entry := element.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		cache.remove(element)
+		ok = false
+		return
+	}
+	cache.order.MoveToFront(element)
+	storage = entry.storage.snapshot()
+	return
+}
+
+func (cache *LRUCache) set(unique string, storage *Storage) {
+	if cache.size <= 0 || storage == nil {
+		return
+	}
+	entry := &lruEntry{unique: unique, storage: storage.snapshot()}
+	if cache.ttl > 0 {
+		entry.expiresAt = time.Now().Add(cache.ttl)
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if element, ok := cache.entries[unique]; ok {
+		element.Value = entry
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.entries[unique] = cache.order.PushFront(entry)
+	for cache.order.Len() > cache.size {
+		cache.remove(cache.order.Back())
+	}
+}
+
+func (cache *LRUCache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*lruEntry).unique)
+}
+
+// 浅复制, 不包含 DocumentBase 的状态
+func (storage *Storage) clone() *Storage {
+	val := *storage
+	val.DocumentBase = mgoModel.DocumentBase{}
+	return &val
+}
+
+func (client *Client) deleteCache(ctx context.Context, unique string) {
+	deleteCache(ctx, client.getCache(), unique)
+}
+
+func deleteCache(ctx context.Context, cache Cache, unique string) {
+	if deleter, ok := cache.(CacheDeleter); ok {
+		deleter.Delete(ctx, unique)
+	}
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRUCacheCopy(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(10, 0, mapCache{})
+	now := time.Now()
+	storage := &Storage{
+		Unique:    "a/b.jpg",
+		Meta:      map[string]interface{}{"exif": map[string]interface{}{"iso": 200}},
+		Tags:      []string{"a"},
+		Variants:  []Variant{{Path: "a/b_100.jpg", Width: 100}},
+		UpdatedAt: &now,
+	}
+	cache.Set(ctx, storage.Unique, storage)
+
+	// 修改写入的文档不影响缓存
+	storage.Tags[0] = "b"
+	storage.Meta["exif"].(map[string]interface{})["iso"] = 400
+
+	val, ok := cache.Get(ctx, storage.Unique)
+	if !ok {
+		t.Fatal("Get() miss")
+	}
+	if val.Tags[0] != "a" || val.Meta["exif"].(map[string]interface{})["iso"] != 200 {
+		t.Fatalf("cache changed by the caller: %v %v", val.Tags, val.Meta)
+	}
+
+	// 修改读取的文档不影响缓存
+	val.Tags[0] = "c"
+	val.Meta["exif"].(map[string]interface{})["iso"] = 800
+	val.Variants[0].Width = 200
+	*val.UpdatedAt = now.Add(time.Hour)
+
+	val, _ = cache.Get(ctx, storage.Unique)
+	if val.Tags[0] != "a" || val.Meta["exif"].(map[string]interface{})["iso"] != 200 || val.Variants[0].Width != 100 || !val.UpdatedAt.Equal(now) {
+		t.Fatalf("cache changed by the caller: %+v", val)
+	}
+}
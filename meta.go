@@ -0,0 +1,179 @@
+package model
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/otamoe/gin-server/errs"
+)
+
+var (
+	// Meta 序列化为 bson 后的最大字节数, 0 不限制
+	MaxMetaBytes = 64 << 10
+	// Meta 最大嵌套层数, 0 不限制
+	MaxMetaDepth = 8
+	// 超过限制时截断而不是返回错误
+	TruncateMeta bool
+
+	ErrStorageMetaTooLarge = &errs.Error{
+		Message:    "Meta is too large",
+		Path:       "meta",
+		Type:       "max",
+		StatusCode: http.StatusBadRequest,
+	}
+
+	ErrStorageMetaTooDeep = &errs.Error{
+		Message:    "Meta is nested too deep",
+		Path:       "meta",
+		Type:       "depth",
+		StatusCode: http.StatusBadRequest,
+	}
+)
+
+func (storage *Storage) MetaString(key string) (val string, ok bool) {
+	val, ok = storage.Meta[key].(string)
+	return
+}
+
+// json 解码的数字为 float64, bson 解码的为 int, int32, int64, 非整数的 float 返回 false
+func (storage *Storage) MetaInt(key string) (val int64, ok bool) {
+	switch v := storage.Meta[key].(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float32:
+		return metaFloatToInt(float64(v))
+	case float64:
+		return metaFloatToInt(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, true
+		}
+	}
+	return
+}
+
+func (storage *Storage) MetaFloat(key string) (val float64, ok bool) {
+	switch v := storage.Meta[key].(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		if n, err := v.Float64(); err == nil {
+			return n, true
+		}
+	}
+	return
+}
+
+func (storage *Storage) MetaBool(key string) (val bool, ok bool) {
+	val, ok = storage.Meta[key].(bool)
+	return
+}
+
+func metaFloatToInt(v float64) (val int64, ok bool) {
+	if v != math.Trunc(v) || v > math.MaxInt64 || v < math.MinInt64 {
+		return
+	}
+	return int64(v), true
+}
+
+// 超过限制时返回 ErrStorageMetaTooLarge, ErrStorageMetaTooDeep, TruncateMeta 为 true 时截断
+func (storage *Storage) limitMeta() (err error) {
+	if len(storage.Meta) == 0 {
+		return
+	}
+	if MaxMetaDepth > 0 && metaDepth(storage.Meta) > MaxMetaDepth {
+		if !TruncateMeta {
+			ginErr := ErrStorageMetaTooDeep.Clone()
+			ginErr.Params = map[string]interface{}{"max": MaxMetaDepth}
+			return ginErr
+		}
+		metaTruncateDepth(storage.Meta, MaxMetaDepth)
+	}
+	if MaxMetaBytes <= 0 {
+		return
+	}
+	var data []byte
+	for {
+		if data, err = bson.Marshal(storage.Meta); err != nil {
+			return
+		}
+		if len(data) <= MaxMetaBytes {
+			return
+		}
+		if !TruncateMeta {
+			ginErr := ErrStorageMetaTooLarge.Clone()
+			ginErr.Params = map[string]interface{}{"max": MaxMetaBytes}
+			return ginErr
+		}
+		// 删除最大的 key
+		var largest string
+		var largestSize int
+		for key, val := range storage.Meta {
+			size := 0
+			if b, e := bson.Marshal(bson.M{key: val}); e == nil {
+				size = len(b)
+			}
+			if largest == "" || size > largestSize || (size == largestSize && key > largest) {
+				largest = key
+				largestSize = size
+			}
+		}
+		delete(storage.Meta, largest)
+	}
+}
+
+func metaDepth(val interface{}) (depth int) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for _, child := range v {
+			if d := metaDepth(child); d > depth {
+				depth = d
+			}
+		}
+		depth++
+	case bson.M:
+		return metaDepth(map[string]interface{}(v))
+	case []interface{}:
+		for _, child := range v {
+			if d := metaDepth(child); d > depth {
+				depth = d
+			}
+		}
+		depth++
+	}
+	return
+}
+
+// 删除超过 depth 层的嵌套值
+func metaTruncateDepth(val map[string]interface{}, depth int) {
+	for key, child := range val {
+		if depth <= 1 && metaDepth(child) > 0 {
+			delete(val, key)
+			continue
+		}
+		switch v := child.(type) {
+		case map[string]interface{}:
+			metaTruncateDepth(v, depth-1)
+		case bson.M:
+			metaTruncateDepth(v, depth-1)
+		case []interface{}:
+			if metaDepth(v) > depth-1 {
+				delete(val, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// Metrics 用于接入 Prometheus, StatsD 等, 实现需要并发安全
+	Metrics interface {
+		// 每次请求源站, 没有响应时 statusCode 为 0
+		ObserveFetch(duration time.Duration, statusCode int, err error)
+		IncCache(hit bool)
+	}
+
+	NoopMetrics struct{}
+
+	MemoryMetrics struct {
+		mu          sync.Mutex
+		Fetches     int
+		FetchErrors int
+		StatusCodes map[int]int
+		Duration    time.Duration
+		CacheHits   int
+		CacheMisses int
+	}
+)
+
+var DefaultMetrics Metrics = NoopMetrics{}
+
+func (NoopMetrics) ObserveFetch(duration time.Duration, statusCode int, err error) {}
+
+func (NoopMetrics) IncCache(hit bool) {}
+
+func (metrics *MemoryMetrics) ObserveFetch(duration time.Duration, statusCode int, err error) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.Fetches++
+	if err != nil {
+		metrics.FetchErrors++
+	}
+	if metrics.StatusCodes == nil {
+		metrics.StatusCodes = map[int]int{}
+	}
+	metrics.StatusCodes[statusCode]++
+	metrics.Duration += duration
+}
+
+func (metrics *MemoryMetrics) IncCache(hit bool) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if hit {
+		metrics.CacheHits++
+	} else {
+		metrics.CacheMisses++
+	}
+}
@@ -1,10 +1,80 @@
 package model
 
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/sirupsen/logrus"
+)
+
 var (
 	StorageOrigin     string
 	StoragePathOrigin string
 	Username          string
 	Password          string
+	BearerToken       string
+
+	// 额外的源站, 排在 StorageOrigin, StoragePathOrigin 之后失败转移
+	StorageOrigins     []string
+	StoragePathOrigins []string
+	// 每次回源最多尝试的源站数量, 0 全部
+	MaxOriginAttempts int
+
+	// 拉取源站的超时时间, <= 0 时使用 DefaultFetchTimeout
+	FetchTimeout = DefaultFetchTimeout
+
+	// 源站 5xx 或网络错误时的重试次数, 0 不重试
+	FetchMaxRetries     int
+	FetchRetryBaseDelay = DefaultFetchRetryBaseDelay
+
+	// 自定义 http client, nil 时使用共享的默认 client
+	HTTPClient *http.Client
+
+	// 回源请求附加的 header, 需要认证的请求 Authorization 以认证配置为准
+	FetchHeaders http.Header
+
+	// GetMany 最大并发数
+	GetManyConcurrency = 8
+
+	// 源站 404 结果的缓存时间, 0 不缓存
+	NegativeCacheTTL time.Duration
+
+	// 源站响应的最大字节数, <= 0 时使用 DefaultMaxResponseBytes
+	MaxResponseBytes = DefaultMaxResponseBytes
+
+	// 同时请求源站的最大数量, 0 不限制
+	MaxConcurrentFetches int
+
+	Logger logrus.FieldLogger = logrus.StandardLogger()
+
+	// 缓存有效期, 仅 Get cache=true 时生效, UpdatedAt + CacheTTL 之后重新拉取
+	// 拉取失败时返回过期的缓存, 0 永不过期
+	CacheTTL time.Duration
+
+	// 缓存过期后的这段时间内直接返回过期的缓存, 同时在后台回源刷新, 0 关闭
+	StaleWhileRevalidate time.Duration
+)
+
+var (
+	DefaultFetchTimeout        = time.Second * 20
+	DefaultFetchRetryBaseDelay = time.Millisecond * 200
+	DefaultMaxResponseBytes    = int64(4 << 20)
+
+	// 单次调用覆盖超时 context.WithValue(ctx, CONTEXT_FETCH_TIMEOUT, time.Second*5)
+	CONTEXT_FETCH_TIMEOUT = "STORAGE.MODEL.FETCH.TIMEOUT"
+
+	// Get 缓存包含已软删除的文档 context.WithValue(ctx, CONTEXT_INCLUDE_DELETED, true)
+	CONTEXT_INCLUDE_DELETED = "STORAGE.MODEL.INCLUDE.DELETED"
+
+	// 单次调用附加的 header, 覆盖 FetchHeaders 同名的 header context.WithValue(ctx, CONTEXT_FETCH_HEADERS, http.Header{})
+	CONTEXT_FETCH_HEADERS = "STORAGE.MODEL.FETCH.HEADERS"
+
+	// 当前的 owner context.WithValue(ctx, CONTEXT_OWNER, bson.ObjectId)
+	CONTEXT_OWNER = "STORAGE.MODEL.OWNER"
+
+	defaultHTTPClient = &http.Client{}
 )
 
 func Config(storageOrigin, storagePathOrigin, username, password string) {
@@ -18,3 +88,13 @@ func Config(storageOrigin, storagePathOrigin, username, password string) {
 func Start() {
 
 }
+
+func contextOwner(ctx context.Context) bson.ObjectId {
+	val, _ := ctx.Value(CONTEXT_OWNER).(bson.ObjectId)
+	return val
+}
+
+func includeDeleted(ctx context.Context) bool {
+	val, _ := ctx.Value(CONTEXT_INCLUDE_DELETED).(bool)
+	return val
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/otamoe/gin-server/errs"
+	"github.com/ugorji/go/codec"
+)
+
+type (
+	storageMsgpackBase Storage
+
+	// ObjectId 和 json 一样使用 hex 字符串, 同名字段覆盖 storageMsgpackBase 的字段
+	storageMsgpack struct {
+		storageMsgpackBase
+
+		ID     string `msgpack:"_id"`
+		Blob   string `msgpack:"blob,omitempty"`
+		Parent string `msgpack:"parent,omitempty"`
+		Owner  string `msgpack:"owner,omitempty"`
+	}
+)
+
+var ErrStorageMsgpackInvalid = &errs.Error{
+	Message:    "Storage: Invalid ObjectId in msgpack data",
+	Path:       "storage",
+	Type:       "objectid",
+	StatusCode: http.StatusBadRequest,
+}
+
+// 使用 msgpack 标签, 没有 msgpack 标签的类型 (errs.Error) 使用 json 标签
+var msgpackHandle = func() (handle *codec.MsgpackHandle) {
+	handle = &codec.MsgpackHandle{WriteExt: true}
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	handle.RawToString = true
+	handle.TypeInfos = codec.NewTypeInfos([]string{"msgpack", "json"})
+	return
+}()
+
+// MarshalMsgpack 和 MarshalJSON 一样默认不输出 HLSKey, DASHKey
+func (storage *Storage) MarshalMsgpack() (data []byte, err error) {
+	val := storageMsgpack{
+		storageMsgpackBase: storageMsgpackBase(*storage),
+		ID:                 idHex(storage.ID),
+		Blob:               idHex(storage.Blob),
+		Parent:             idHex(storage.Parent),
+		Owner:              idHex(storage.Owner),
+	}
+	if !val.IncludeHLSKey {
+		val.HLSKey = ""
+		val.DASHKey = ""
+	}
+	err = codec.NewEncoderBytes(&data, msgpackHandle).Encode(&val)
+	return
+}
+
+func (storage *Storage) UnmarshalMsgpack(data []byte) (err error) {
+	val := storageMsgpack{}
+	if err = codec.NewDecoderBytes(data, msgpackHandle).Decode(&val); err != nil {
+		return
+	}
+	res := Storage(val.storageMsgpackBase)
+	for _, id := range []struct {
+		hex string
+		val *bson.ObjectId
+	}{
+		{val.ID, &res.ID},
+		{val.Blob, &res.Blob},
+		{val.Parent, &res.Parent},
+		{val.Owner, &res.Owner},
+	} {
+		*id.val = ""
+		if id.hex == "" {
+			continue
+		}
+		if !bson.IsObjectIdHex(id.hex) {
+			err = ErrStorageMsgpackInvalid
+			return
+		}
+		*id.val = bson.ObjectIdHex(id.hex)
+	}
+	*storage = res
+	return
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/ugorji/go/codec"
+)
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	now := time.Now().UTC()
+	storage := &Storage{
+		ID:        bson.NewObjectId(),
+		Owner:     bson.NewObjectId(),
+		Parent:    bson.NewObjectId(),
+		Unique:    "a/b.jpg",
+		Path:      "b.jpg",
+		Status:    StatusApproved,
+		Meta:      map[string]interface{}{"a": 1.5, "b": map[string]interface{}{"c": "d"}},
+		Tags:      []string{"x"},
+		Variants:  []Variant{{Path: "b_320.jpg", Width: 320}},
+		CreatedAt: &now,
+	}
+	data, err := storage.MarshalMsgpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(storage.ID)) {
+		t.Fatal("_id encoded as raw bytes")
+	}
+
+	// 其他语言解码得到 hex 字符串
+	var m map[string]interface{}
+	if err = codec.NewDecoderBytes(data, msgpackHandle).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	for key, id := range map[string]bson.ObjectId{"_id": storage.ID, "owner": storage.Owner, "parent": storage.Parent} {
+		if m[key] != id.Hex() {
+			t.Errorf("%s = %#v, want %q", key, m[key], id.Hex())
+		}
+	}
+	if _, ok := m["blob"]; ok {
+		t.Error("empty blob should be omitted")
+	}
+
+	res := &Storage{}
+	if err = res.UnmarshalMsgpack(data); err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != storage.ID || res.Owner != storage.Owner || res.Parent != storage.Parent || res.Blob != "" {
+		t.Fatalf("ids = %v %v %v %v", res.ID, res.Owner, res.Parent, res.Blob)
+	}
+	if !reflect.DeepEqual(res.Meta, storage.Meta) || !reflect.DeepEqual(res.Variants, storage.Variants) || !res.CreatedAt.Equal(now) {
+		t.Fatalf("unexpected storage %+v", res)
+	}
+
+	m = map[string]interface{}{"_id": "xyz"}
+	var bad []byte
+	if err = codec.NewEncoderBytes(&bad, msgpackHandle).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	if err = res.UnmarshalMsgpack(bad); err != ErrStorageMsgpackInvalid {
+		t.Fatalf("invalid _id: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package model
+
+import (
+	"context"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+
+	"github.com/otamoe/gin-server/errs"
+)
+
+type (
+	RangeReader struct {
+		io.ReadCloser
+		// 源站返回 206 部分内容
+		Partial bool
+	}
+)
+
+var ErrStorageRangeNotSatisfiable error = &errs.Error{
+	Message:    "Storage: Range not satisfiable",
+	Path:       "range",
+	Type:       "range",
+	StatusCode: http.StatusRequestedRangeNotSatisfiable,
+}
+
+func (storage *Storage) Open(ctx context.Context) (body io.ReadCloser, err error) {
+	return defaultClient().Open(ctx, storage)
+}
+
+// Open 流式读取文件内容, 调用方负责 Close
+func (client *Client) Open(ctx context.Context, storage *Storage) (body io.ReadCloser, err error) {
+	var res *http.Response
+	if res, err = client.openFile(ctx, storage, nil); err != nil {
+		return
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		err = statusError(res.StatusCode)
+		return
+	}
+	body = res.Body
+	return
+}
+
+func (storage *Storage) OpenRange(ctx context.Context, start, end int64) (body io.ReadCloser, total int64, err error) {
+	return defaultClient().OpenRange(ctx, storage, start, end)
+}
+
+// OpenRange 读取 [start, end] 字节, end < 0 读到结尾, total 为文件总大小, 未知时为 -1
+// 返回的 body 为 *RangeReader, 源站忽略 Range 返回完整内容时 Partial 为 false
+func (client *Client) OpenRange(ctx context.Context, storage *Storage, start, end int64) (body io.ReadCloser, total int64, err error) {
+	total = -1
+	if start < 0 || (end >= 0 && end < start) {
+		err = ErrStorageRangeNotSatisfiable
+		return
+	}
+	rangeHeader := "bytes=" + strconv.FormatInt(start, 10) + "-"
+	if end >= 0 {
+		rangeHeader += strconv.FormatInt(end, 10)
+	}
+
+	var res *http.Response
+	if res, err = client.openFile(ctx, storage, http.Header{"Range": []string{rangeHeader}}); err != nil {
+		return
+	}
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		total = parseContentRangeTotal(res.Header.Get("Content-Range"))
+		body = &RangeReader{ReadCloser: res.Body, Partial: true}
+	case http.StatusOK:
+		total = res.ContentLength
+		body = &RangeReader{ReadCloser: res.Body}
+	case http.StatusRequestedRangeNotSatisfiable:
+		res.Body.Close()
+		err = ErrStorageRangeNotSatisfiable
+	default:
+		res.Body.Close()
+		err = statusError(res.StatusCode)
+	}
+	return
+}
+
+// Content-Range: bytes 0-99/1234, 总大小为 * 时返回 -1
+func parseContentRangeTotal(val string) (total int64) {
+	total = -1
+	index := strings.LastIndex(val, "/")
+	if index == -1 {
+		return
+	}
+	if n, err := strconv.ParseInt(strings.TrimSpace(val[index+1:]), 10, 64); err == nil {
+		total = n
+	}
+	return
+}
+
+func (client *Client) fileURL(storage *Storage) (url string, auth bool, err error) {
+	return client.pathURL(storage, storage.Path)
+}
+
+// 文件地址: path 为完整 url 时直接使用, 否则拼接在 Storage.URL 对应的源站后
+func (client *Client) pathURL(storage *Storage, path string) (url string, auth bool, err error) {
+	if path == "" {
+		err = ErrStorageNotFound
+		return
+	}
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		// 重新序列化, 编码路径中的 unicode 字符
+		var u *neturl.URL
+		if u, err = neturl.Parse(path); err != nil {
+			err = ErrStorageNotFound
+			return
+		}
+		url = u.String()
+		return
+	}
+	var escaped string
+	if escaped, err = escapeFilePath(strings.TrimLeft(path, "/")); err != nil {
+		return
+	}
+	if _, auth, err = client.urls(storage.Unique); err != nil {
+		return
+	}
+	origins := client.storageOrigins
+	if auth {
+		origins = client.storagePathOrigins
+	}
+	url = origins[0] + "/" + escaped
+	return
+}
+
+// 不使用 fetch 的超时, 读取时间由调用方的 ctx 控制
+func (client *Client) openFile(ctx context.Context, storage *Storage, header http.Header) (res *http.Response, err error) {
+	var url string
+	var auth bool
+	if url, auth, err = client.fileURL(storage); err != nil {
+		return
+	}
+
+	var req *http.Request
+	if req, err = http.NewRequest("GET", url, nil); err != nil {
+		err = ErrStorageNotFound
+		return
+	}
+	for key, vals := range header {
+		req.Header[key] = vals
+	}
+	if auth {
+		if err = client.setAuth(req); err != nil {
+			return
+		}
+	}
+	res, err = client.getHTTPClient().Do(req.WithContext(ctx))
+	return
+}
+
+func statusError(statusCode int) error {
+	if statusCode == http.StatusNotFound || statusCode == http.StatusGone {
+		return ErrStorageNotFound
+	}
+	return &errs.Error{
+		Message:    "Storage: Status code error",
+		StatusCode: statusCode,
+	}
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/otamoe/gin-server/errs"
+	"golang.org/x/text/unicode/norm"
+)
+
+var ErrStorageInvalidPath = &errs.Error{
+	Message:    "Storage: Invalid path",
+	Path:       "path",
+	Type:       "invalid",
+	StatusCode: http.StatusBadRequest,
+}
+
+// 按路径查询的 val 检查后返回重新编码的路径, 每段使用 NFC 规范化
+func encodePath(val string) (p string, err error) {
+	if err = sanitizePath(val); err != nil {
+		return
+	}
+	segments := strings.Split(val, "/")
+	for i, segment := range segments {
+		var decoded string
+		if decoded, err = url.PathUnescape(segment); err != nil {
+			err = ErrStorageNotFound
+			return
+		}
+		segments[i] = url.PathEscape(norm.NFC.String(decoded))
+	}
+	p = strings.Join(segments, "/")
+	return
+}
+
+// 源站返回的 Path 逐段编码, 已编码的保持不变, 不允许 . .. 和控制字符
+func escapeFilePath(val string) (p string, err error) {
+	segments := strings.Split(val, "/")
+	for i, segment := range segments {
+		decoded, e := url.PathUnescape(segment)
+		if e != nil {
+			decoded = segment
+		}
+		if decoded == "." || decoded == ".." {
+			err = ErrStorageNotFound
+			return
+		}
+		for _, r := range decoded {
+			if unicode.IsControl(r) {
+				err = ErrStorageNotFound
+				return
+			}
+		}
+		segments[i] = url.PathEscape(norm.NFC.String(decoded))
+	}
+	p = strings.Join(segments, "/")
+	return
+}
+
+// 解码并规范化 (NFC, NFKC) 之后按 path.Clean 检查, 不能有 . .. 空的段, 不能离开根目录
+// 每段不能以 . 开头, 首尾不能有空白, 不能包含控制字符和 :*?#&<>\
+// 编码的 / (%2f) 也视为分隔符, 有疑问时拒绝, 包含 \ (包括 %5c) 时返回 ErrStorageInvalidPath
+func sanitizePath(val string) (err error) {
+	err = ErrStorageNotFound
+	if val == "" {
+		return
+	}
+	var decoded string
+	if decoded, err = url.PathUnescape(val); err != nil {
+		err = ErrStorageNotFound
+		return
+	}
+	err = ErrStorageNotFound
+	if !utf8.ValidString(decoded) {
+		return
+	}
+	// 已编码的 / 必须和原始的 / 一致, 避免 a%2f..%2fb 绕过分段检查
+	if strings.Count(decoded, "/") != strings.Count(val, "/") {
+		return
+	}
+	for _, form := range []norm.Form{norm.NFC, norm.NFKC} {
+		normalized := form.String(decoded)
+		if strings.Contains(normalized, "\\") {
+			err = ErrStorageInvalidPath
+			return
+		}
+		if path.Clean("/"+normalized) != "/"+normalized {
+			return
+		}
+		for _, segment := range strings.Split(normalized, "/") {
+			if segment == "" || strings.TrimSpace(segment) != segment || segment[0] == '.' || strings.ContainsAny(segment, ":*?#&<>") {
+				return
+			}
+			for _, r := range segment {
+				if unicode.IsControl(r) || r == utf8.RuneError {
+					return
+				}
+			}
+		}
+	}
+	err = nil
+	return
+}
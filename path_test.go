@@ -0,0 +1,85 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestSanitizePath(t *testing.T) {
+	tests := []struct {
+		val string
+		err error
+	}{
+		{"a/b.jpg", nil},
+		{"a/%E4%B8%AD.jpg", nil},
+		{"a\\b", ErrStorageInvalidPath},
+		{"a%5Cb", ErrStorageInvalidPath},
+		{"a%5cb", ErrStorageInvalidPath},
+		{"a/＼b", ErrStorageInvalidPath},
+		{"..", ErrStorageNotFound},
+		{"a/../b", ErrStorageNotFound},
+		{"a/%2E%2E/b", ErrStorageNotFound},
+		{"a%2Fb", ErrStorageNotFound},
+		{"a%2f..%2fb", ErrStorageNotFound},
+		{"", ErrStorageNotFound},
+		{"a//b", ErrStorageNotFound},
+		{".hidden", ErrStorageNotFound},
+	}
+	for _, test := range tests {
+		if err := sanitizePath(test.val); err != test.err {
+			t.Errorf("sanitizePath(%q) = %v, want %v", test.val, err, test.err)
+		}
+	}
+}
+
+func TestEncodePath(t *testing.T) {
+	tests := []struct {
+		val  string
+		want string
+		err  error
+	}{
+		{"中文/文件.jpg", "%E4%B8%AD%E6%96%87/%E6%96%87%E4%BB%B6.jpg", nil},
+		{"%E4%B8%AD%E6%96%87/a.jpg", "%E4%B8%AD%E6%96%87/a.jpg", nil},
+		{"emoji/😀.png", "emoji/%F0%9F%98%80.png", nil},
+		{"a b/c d.jpg", "a%20b/c%20d.jpg", nil},
+		{"a%20b/c.jpg", "a%20b/c.jpg", nil},
+		// NFC
+		{"cafe\u0301/a.jpg", "caf%C3%A9/a.jpg", nil},
+		{"café/a.jpg", "caf%C3%A9/a.jpg", nil},
+		{"a/b+c@d=e.jpg", "a/b+c@d=e.jpg", nil},
+		{"a/b;c.jpg", "a/b%3Bc.jpg", nil},
+		{"a/b%25c.jpg", "a/b%25c.jpg", nil},
+		{"a/b?c", "", ErrStorageNotFound},
+		{"a/b#c", "", ErrStorageNotFound},
+		{"a/b&c", "", ErrStorageNotFound},
+	}
+	for _, test := range tests {
+		got, err := encodePath(test.val)
+		if got != test.want || err != test.err {
+			t.Errorf("encodePath(%q) = %q, %v, want %q, %v", test.val, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestEscapeFilePath(t *testing.T) {
+	tests := []struct {
+		val  string
+		want string
+		err  error
+	}{
+		{"中文/文件.jpg", "%E4%B8%AD%E6%96%87/%E6%96%87%E4%BB%B6.jpg", nil},
+		{"emoji/😀.png", "emoji/%F0%9F%98%80.png", nil},
+		{"a b/c d.jpg", "a%20b/c%20d.jpg", nil},
+		{"a%20b/c.jpg", "a%20b/c.jpg", nil},
+		{"a/b?c#d", "a/b%3Fc%23d", nil},
+		{"a/b;c.jpg", "a/b%3Bc.jpg", nil},
+		{"a/../b", "", ErrStorageNotFound},
+		{"a/%2E%2E/b", "", ErrStorageNotFound},
+		{"a/b\x00c", "", ErrStorageNotFound},
+	}
+	for _, test := range tests {
+		got, err := escapeFilePath(test.val)
+		if got != test.want || err != test.err {
+			t.Errorf("escapeFilePath(%q) = %q, %v, want %q, %v", test.val, got, err, test.want, test.err)
+		}
+	}
+}
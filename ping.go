@@ -0,0 +1,63 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/otamoe/gin-server/errs"
+)
+
+var (
+	// Ping 请求的路径, 空时请求源站根目录
+	PingPath string
+
+	// Params 的 origins 为每个源站的结果
+	ErrStorageOriginUnavailable = &errs.Error{
+		Message:    "Storage: Origin unavailable",
+		Path:       "storage",
+		Type:       "unavailable",
+		StatusCode: http.StatusServiceUnavailable,
+	}
+)
+
+func Ping(ctx context.Context) (err error) {
+	return defaultClient().Ping(ctx)
+}
+
+// 对每个源站发送 HEAD 请求, 网络错误或 5xx 视为失败
+func (client *Client) Ping(ctx context.Context) (err error) {
+	results := map[string]string{}
+	var first error
+	ping := func(origin string, auth bool) {
+		if _, ok := results[origin]; ok {
+			return
+		}
+		url := origin + "/" + strings.TrimLeft(PingPath, "/")
+		res, e := client.head(ctx, url, auth, nil)
+		if e == nil && res.StatusCode >= 500 {
+			e = fmt.Errorf("status code %d", res.StatusCode)
+		}
+		if e != nil {
+			results[origin] = e.Error()
+			if first == nil {
+				first = e
+			}
+			return
+		}
+		results[origin] = "ok"
+	}
+	for _, origin := range client.storageOrigins {
+		ping(origin, false)
+	}
+	for _, origin := range client.storagePathOrigins {
+		ping(origin, true)
+	}
+	if first != nil {
+		wrapped := wrapError(ErrStorageOriginUnavailable, first)
+		wrapped.GinError.Params = map[string]interface{}{"origins": results}
+		err = wrapped
+	}
+	return
+}
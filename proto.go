@@ -0,0 +1,260 @@
+package model
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/otamoe/gin-server/errs"
+	"github.com/otamoe/storage-model/pb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	ErrStorageProtoInvalid = &errs.Error{
+		Message:    "Storage: Invalid ObjectId in protobuf message",
+		Path:       "storage",
+		Type:       "objectid",
+		StatusCode: http.StatusBadRequest,
+	}
+
+	// 为 true 时 ToProto 和 MarshalJSON 一样只在 IncludeHLSKey 时输出 HLSKey, DASHKey, 默认总是输出
+	ProtoOmitKeys bool
+)
+
+// ToProto 和 FromProto 不是无损的:
+//   - ProtoOmitKeys 为 true 且 IncludeHLSKey 为 false 时不输出 HLSKey, DASHKey, FromProto 之后为空
+//   - Meta, Errors 的 Value, Params 按 json 转换为 google.protobuf.Struct, 所有数字 FromProto 之后为 float64,
+//     超过 2^53 的整数会丢失精度, ObjectId, time.Time 等转换为 json 的字符串
+//   - 不包含 Warnings
+func (storage *Storage) ToProto() (val *pb.Storage, err error) {
+	val = &pb.Storage{
+		Id:          idHex(storage.ID),
+		Unique:      storage.Unique,
+		Path:        storage.Path,
+		Hls:         storage.HLS,
+		Dash:        storage.DASH,
+		Status:      storage.Status,
+		Name:        storage.Name,
+		Type:        storage.Type,
+		SubType:     storage.SubType,
+		Size:        storage.Size,
+		Duration:    storage.Duration,
+		Width:       int32(storage.Width),
+		Height:      int32(storage.Height),
+		Pixels:      int64(storage.Pixels),
+		Complete:    storage.Complete,
+		Version:     storage.Version,
+		Etag:        storage.ETag,
+		Sha256:      storage.SHA256,
+		RefCount:    int32(storage.RefCount),
+		Blob:        idHex(storage.Blob),
+		PendingGc:   storage.PendingGC,
+		Parent:      idHex(storage.Parent),
+		Owner:       idHex(storage.Owner),
+		Tags:        storage.Tags,
+		CreatedAt:   protoTime(storage.CreatedAt),
+		UpdatedAt:   protoTime(storage.UpdatedAt),
+		DeletedAt:   protoTime(storage.DeletedAt),
+		ExpiresAt:   protoTime(storage.ExpiresAt),
+		StatusCode:  int32(storage.StatusCode),
+		Subtitles:   protoTracks(storage.Subtitles),
+		AudioTracks: protoTracks(storage.AudioTracks),
+	}
+	if !ProtoOmitKeys || storage.IncludeHLSKey {
+		val.HlsKey = string(storage.HLSKey)
+		val.DashKey = string(storage.DASHKey)
+	}
+	if val.Meta, err = protoStruct(storage.Meta); err != nil {
+		return
+	}
+	for _, variant := range storage.Variants {
+		val.Variants = append(val.Variants, &pb.Variant{
+			Path:    variant.Path,
+			Width:   int32(variant.Width),
+			Height:  int32(variant.Height),
+			Size:    variant.Size,
+			Type:    variant.Type,
+			SubType: variant.SubType,
+		})
+	}
+	for _, e := range storage.Errors {
+		if e == nil {
+			continue
+		}
+		ginErr := &pb.Error{
+			Message:    e.Message,
+			Name:       e.Name,
+			Type:       e.Type,
+			Path:       e.Path,
+			StatusCode: int32(e.StatusCode),
+		}
+		if e.Value != nil {
+			var value interface{}
+			if value, err = jsonValue(e.Value); err != nil {
+				return
+			}
+			if ginErr.Value, err = structpb.NewValue(value); err != nil {
+				return
+			}
+		}
+		if ginErr.Params, err = protoStruct(e.Params); err != nil {
+			return
+		}
+		val.Errors = append(val.Errors, ginErr)
+	}
+	return
+}
+
+// FromProto 转换 ToProto 的结果, 限制见 ToProto
+func FromProto(val *pb.Storage) (storage *Storage, err error) {
+	storage = &Storage{
+		Unique:      val.GetUnique(),
+		Path:        val.GetPath(),
+		HLS:         val.GetHls(),
+		HLSKey:      EncryptedString(val.GetHlsKey()),
+		DASH:        val.GetDash(),
+		DASHKey:     EncryptedString(val.GetDashKey()),
+		Status:      val.GetStatus(),
+		Name:        val.GetName(),
+		Type:        val.GetType(),
+		SubType:     val.GetSubType(),
+		Size:        val.GetSize(),
+		Duration:    val.GetDuration(),
+		Width:       int(val.GetWidth()),
+		Height:      int(val.GetHeight()),
+		Pixels:      int(val.GetPixels()),
+		Complete:    val.GetComplete(),
+		Version:     val.GetVersion(),
+		ETag:        val.GetEtag(),
+		SHA256:      val.GetSha256(),
+		RefCount:    int(val.GetRefCount()),
+		PendingGC:   val.GetPendingGc(),
+		Tags:        val.GetTags(),
+		CreatedAt:   fromProtoTime(val.GetCreatedAt()),
+		UpdatedAt:   fromProtoTime(val.GetUpdatedAt()),
+		DeletedAt:   fromProtoTime(val.GetDeletedAt()),
+		ExpiresAt:   fromProtoTime(val.GetExpiresAt()),
+		StatusCode:  int(val.GetStatusCode()),
+		Subtitles:   fromProtoTracks(val.GetSubtitles()),
+		AudioTracks: fromProtoTracks(val.GetAudioTracks()),
+	}
+	if val.GetMeta() != nil {
+		storage.Meta = val.GetMeta().AsMap()
+	}
+	for _, id := range []struct {
+		hex string
+		val *bson.ObjectId
+	}{
+		{val.GetId(), &storage.ID},
+		{val.GetBlob(), &storage.Blob},
+		{val.GetParent(), &storage.Parent},
+		{val.GetOwner(), &storage.Owner},
+	} {
+		if id.hex == "" {
+			continue
+		}
+		if !bson.IsObjectIdHex(id.hex) {
+			err = ErrStorageProtoInvalid
+			return
+		}
+		*id.val = bson.ObjectIdHex(id.hex)
+	}
+	for _, variant := range val.GetVariants() {
+		storage.Variants = append(storage.Variants, Variant{
+			Path:    variant.GetPath(),
+			Width:   int(variant.GetWidth()),
+			Height:  int(variant.GetHeight()),
+			Size:    variant.GetSize(),
+			Type:    variant.GetType(),
+			SubType: variant.GetSubType(),
+		})
+	}
+	for _, e := range val.GetErrors() {
+		ginErr := &errs.Error{
+			Message:    e.GetMessage(),
+			Name:       e.GetName(),
+			Type:       e.GetType(),
+			Path:       e.GetPath(),
+			StatusCode: int(e.GetStatusCode()),
+		}
+		if e.GetValue() != nil {
+			ginErr.Value = e.GetValue().AsInterface()
+		}
+		if e.GetParams() != nil {
+			ginErr.Params = e.GetParams().AsMap()
+		}
+		storage.Errors = append(storage.Errors, ginErr)
+	}
+	return
+}
+
+func idHex(id bson.ObjectId) string {
+	if id == "" {
+		return ""
+	}
+	return id.Hex()
+}
+
+func protoTime(val *time.Time) *timestamppb.Timestamp {
+	if val == nil {
+		return nil
+	}
+	return timestamppb.New(*val)
+}
+
+func fromProtoTime(val *timestamppb.Timestamp) *time.Time {
+	if val == nil {
+		return nil
+	}
+	t := val.AsTime()
+	return &t
+}
+
+func protoTracks(tracks []Track) (vals []*pb.Track) {
+	for _, track := range tracks {
+		vals = append(vals, &pb.Track{
+			Language: track.Language,
+			Label:    track.Label,
+			Path:     track.Path,
+			Codec:    track.Codec,
+		})
+	}
+	return
+}
+
+func fromProtoTracks(vals []*pb.Track) (tracks []Track) {
+	for _, val := range vals {
+		tracks = append(tracks, Track{
+			Language: val.GetLanguage(),
+			Label:    val.GetLabel(),
+			Path:     val.GetPath(),
+			Codec:    val.GetCodec(),
+		})
+	}
+	return
+}
+
+// 先转换为 json 的类型, ObjectId, time.Time 等 structpb 不支持的类型按 json 输出
+func protoStruct(val map[string]interface{}) (s *structpb.Struct, err error) {
+	if val == nil {
+		return
+	}
+	var m interface{}
+	if m, err = jsonValue(val); err != nil {
+		return
+	}
+	s, err = structpb.NewStruct(m.(map[string]interface{}))
+	return
+}
+
+func jsonValue(val interface{}) (res interface{}, err error) {
+	var data []byte
+	if data, err = json.Marshal(val); err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &res)
+	return
+}
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	now := time.Now().UTC()
+	storage := &Storage{
+		ID:      bson.NewObjectId(),
+		Unique:  "a/b.jpg",
+		Path:    "b.jpg",
+		Status:  StatusApproved,
+		HLSKey:  "hls-key",
+		DASHKey: "dash-key",
+		Meta: map[string]interface{}{
+			"int":    42,
+			"float":  1.5,
+			"string": "s",
+			"bool":   true,
+			"nested": map[string]interface{}{"n": int64(7)},
+			"list":   []interface{}{1, "a"},
+		},
+		Variants:  []Variant{{Path: "b_320.jpg", Width: 320}},
+		CreatedAt: &now,
+	}
+
+	val, err := storage.ToProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := FromProto(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.HLSKey != storage.HLSKey || res.DASHKey != storage.DASHKey {
+		t.Fatalf("keys = %q %q", res.HLSKey, res.DASHKey)
+	}
+
+	// 数字统一为 float64
+	wantMeta := map[string]interface{}{
+		"int":    float64(42),
+		"float":  1.5,
+		"string": "s",
+		"bool":   true,
+		"nested": map[string]interface{}{"n": float64(7)},
+		"list":   []interface{}{float64(1), "a"},
+	}
+	if !reflect.DeepEqual(res.Meta, wantMeta) {
+		t.Fatalf("Meta = %#v, want %#v", res.Meta, wantMeta)
+	}
+	if res.ID != storage.ID || res.Unique != storage.Unique || !res.CreatedAt.Equal(now) {
+		t.Fatalf("unexpected storage %+v", res)
+	}
+	if !reflect.DeepEqual(res.Variants, storage.Variants) {
+		t.Fatalf("Variants = %+v", res.Variants)
+	}
+
+}
+
+func TestProtoOmitKeys(t *testing.T) {
+	defer func(val bool) { ProtoOmitKeys = val }(ProtoOmitKeys)
+	ProtoOmitKeys = true
+	storage := &Storage{Unique: "a/b.m3u8", HLSKey: "hls-key", DASHKey: "dash-key"}
+
+	val, err := storage.ToProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.HlsKey != "" || val.DashKey != "" {
+		t.Fatalf("keys should be omitted without IncludeHLSKey: %q %q", val.HlsKey, val.DashKey)
+	}
+
+	storage.IncludeHLSKey = true
+	if val, err = storage.ToProto(); err != nil {
+		t.Fatal(err)
+	}
+	if val.HlsKey != string(storage.HLSKey) || val.DashKey != string(storage.DASHKey) {
+		t.Fatalf("keys = %q %q", val.HlsKey, val.DashKey)
+	}
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/otamoe/gin-server/errs"
+)
+
+var (
+	// 返回 owner 的配额字节数, <= 0 不限制, nil 不检查配额
+	QuotaLookup func(ctx context.Context, owner bson.ObjectId) (limit int64, err error)
+
+	ErrQuotaExceeded = &errs.Error{
+		Message:    "Storage quota exceeded",
+		Path:       "size",
+		Type:       "quota",
+		StatusCode: http.StatusForbidden,
+	}
+)
+
+// owner 未删除文件的 size 总和
+func UsedBytes(ctx context.Context, owner bson.ObjectId) (used int64, err error) {
+	var result struct {
+		Size int64 `bson:"size"`
+	}
+	pipeline := []bson.M{
+		{"$match": ModelStorage.Query(ctx).Eq("owner", owner).NeDeleted().Map()},
+		{"$group": bson.M{"_id": nil, "size": bson.M{"$sum": "$size"}}},
+	}
+	if err = ModelStorage.DB(ctx).Pipe(pipeline).One(&result); err == mgo.ErrNotFound {
+		err = nil
+	}
+	used = result.Size
+	return
+}
+
+// 插入新文件前检查 owner 的配额
+func (storage *Storage) checkQuota() (err error) {
+	if QuotaLookup == nil || storage.Owner == "" || storage.Size <= 0 {
+		return
+	}
+	ctx := storage.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var limit int64
+	if limit, err = QuotaLookup(ctx, storage.Owner); err != nil || limit <= 0 {
+		return
+	}
+	var used int64
+	if used, err = UsedBytes(ctx, storage.Owner); err != nil {
+		return
+	}
+	if used+storage.Size > limit {
+		ginErr := ErrQuotaExceeded.Clone()
+		ginErr.Params = map[string]interface{}{"limit": limit, "used": used, "size": storage.Size}
+		err = ginErr
+	}
+	return
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"encoding/json"
+	"regexp"
+)
+
+var redactKeyRegexp = regexp.MustCompile(`("(?:hls|dash)_key"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// MarshalJSON 默认不输出 HLSKey, DASHKey, IncludeHLSKey 为 true 时输出
+func (storage Storage) MarshalJSON() ([]byte, error) {
+	type storageJSON Storage
+	val := storageJSON(storage)
+	if !val.IncludeHLSKey {
+		val.HLSKey = ""
+		val.DASHKey = ""
+	}
+	return json.Marshal(val)
+}
+
+// SecretHLSKey 明确需要读取密钥时使用
+func (storage *Storage) SecretHLSKey() string {
+	return string(storage.HLSKey)
+}
+
+func (storage *Storage) SecretDASHKey() string {
+	return string(storage.DASHKey)
+}
+
+// 日志中隐藏密钥
+func redactBody(body []byte) string {
+	return redactKeyRegexp.ReplaceAllString(string(body), `$1"[REDACTED]"`)
+}
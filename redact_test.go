@@ -0,0 +1,58 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMarshalJSONKeys(t *testing.T) {
+	tests := []struct {
+		include bool
+		want    bool
+	}{
+		{false, false},
+		{true, true},
+	}
+	for _, test := range tests {
+		storage := Storage{
+			Unique:        "a/b.m3u8",
+			HLSKey:        "hls-secret",
+			DASHKey:       "dash-secret",
+			IncludeHLSKey: test.include,
+		}
+		for _, val := range []interface{}{storage, &storage} {
+			data, err := json.Marshal(val)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var m map[string]interface{}
+			if err = json.Unmarshal(data, &m); err != nil {
+				t.Fatal(err)
+			}
+			for key, secret := range map[string]string{"hls_key": "hls-secret", "dash_key": "dash-secret"} {
+				_, ok := m[key]
+				if ok != test.want {
+					t.Errorf("IncludeHLSKey=%v: %s present = %v, want %v", test.include, key, ok, test.want)
+				}
+				if !test.want && strings.Contains(string(data), secret) {
+					t.Errorf("IncludeHLSKey=%v: %s leaked in %s", test.include, key, data)
+				}
+			}
+			if m["unique"] != storage.Unique {
+				t.Errorf("unique = %v", m["unique"])
+			}
+		}
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	body := `{"unique":"a","hls_key":"hls-secret","dash_key" : "dash\"secret"}`
+	got := redactBody([]byte(body))
+	if strings.Contains(got, "secret") {
+		t.Fatalf("redactBody() = %s", got)
+	}
+	if !strings.Contains(got, `"unique":"a"`) {
+		t.Fatalf("redactBody() = %s", got)
+	}
+}
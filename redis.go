@@ -0,0 +1,82 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type (
+	// 多个实例共享的缓存, json 序列化, 不包含 HLSKey, DASHKey
+	// redis 不可用时视为未命中, 继续读取 Next
+	RedisCache struct {
+		Client redis.UniversalClient
+		// key 前缀, 默认 storage:
+		Prefix string
+		// 过期时间, 0 不过期
+		TTL time.Duration
+		// 未命中时读取, 例如 MongoCache{}, nil 时只使用 redis
+		Next Cache
+	}
+)
+
+func NewRedisCache(client redis.UniversalClient, ttl time.Duration, next Cache) *RedisCache {
+	return &RedisCache{
+		Client: client,
+		Prefix: "storage:",
+		TTL:    ttl,
+		Next:   next,
+	}
+}
+
+func (cache *RedisCache) Get(ctx context.Context, unique string) (storage *Storage, ok bool) {
+	data, err := cache.Client.Get(ctx, cache.Prefix+unique).Bytes()
+	if err == nil {
+		storage = &Storage{}
+		if err = json.Unmarshal(data, storage); err == nil {
+			ok = true
+			return
+		}
+		storage = nil
+	}
+	if err != redis.Nil {
+		Logger.WithError(err).WithField("unique", unique).Warn("[Storage] redis cache get")
+	}
+	if cache.Next != nil {
+		if storage, ok = cache.Next.Get(ctx, unique); ok {
+			cache.set(ctx, unique, storage)
+		}
+	}
+	return
+}
+
+func (cache *RedisCache) Set(ctx context.Context, unique string, storage *Storage) {
+	cache.set(ctx, unique, storage)
+	if cache.Next != nil {
+		cache.Next.Set(ctx, unique, storage)
+	}
+}
+
+func (cache *RedisCache) Delete(ctx context.Context, unique string) {
+	if err := cache.Client.Del(ctx, cache.Prefix+unique).Err(); err != nil {
+		Logger.WithError(err).WithField("unique", unique).Warn("[Storage] redis cache delete")
+	}
+	if cache.Next != nil {
+		deleteCache(ctx, cache.Next, unique)
+	}
+}
+
+func (cache *RedisCache) set(ctx context.Context, unique string, storage *Storage) {
+	if storage == nil {
+		return
+	}
+	data, err := json.Marshal(storage)
+	if err == nil {
+		err = cache.Client.Set(ctx, cache.Prefix+unique, data, cache.TTL).Err()
+	}
+	if err != nil {
+		Logger.WithError(err).WithField("unique", unique).Warn("[Storage] redis cache set")
+	}
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	mgoModel "github.com/otamoe/mgo-model"
+)
+
+type (
+	// 保留 ctx 的值, 不继承取消和 deadline
+	detachedContext struct {
+		context.Context
+	}
+)
+
+var revalidating = &revalidateGroup{urls: map[string]bool{}}
+
+func (ctx detachedContext) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+func (ctx detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (ctx detachedContext) Err() error {
+	return nil
+}
+
+// 过期不超过 StaleWhileRevalidate 时在后台刷新并返回 true, 同一个 url 同时只刷新一次
+func (client *Client) revalidate(ctx context.Context, val string, urls []string, auth bool, cached *Storage, owner bson.ObjectId) bool {
+	if StaleWhileRevalidate <= 0 {
+		return false
+	}
+	expiresAt, ok := cached.expiresAt()
+	if !ok || time.Since(expiresAt) > StaleWhileRevalidate {
+		return false
+	}
+	session, ok := ctx.Value(mgoModel.CONTEXT).(*mgo.Session)
+	if !ok {
+		return false
+	}
+	if !revalidating.start(urls[0]) {
+		return true
+	}
+
+	// 请求结束后 session 可能会被关闭, 使用复制的 session
+	session = session.Copy()
+	bgCtx := context.WithValue(detachedContext{ctx}, mgoModel.CONTEXT, session)
+	bgCtx, cancel := context.WithTimeout(bgCtx, client.fetchTimeout(ctx))
+	old := cached.clone()
+	go func() {
+		defer revalidating.done(urls[0])
+		defer session.Close()
+		defer cancel()
+		if _, _, err := client.getShared(bgCtx, &getRequest{
+			val:    val,
+			urls:   urls,
+			auth:   auth,
+			cached: old,
+			save:   true,
+			owner:  owner,
+		}); err != nil {
+			Logger.WithError(err).WithField("unique", val).Warn("[Storage] revalidate")
+		}
+	}()
+	return true
+}
+
+func (group *revalidateGroup) start(url string) bool {
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	if group.urls[url] {
+		return false
+	}
+	group.urls[url] = true
+	return true
+}
+
+func (group *revalidateGroup) done(url string) {
+	group.mu.Lock()
+	delete(group.urls, url)
+	group.mu.Unlock()
+}
@@ -0,0 +1,131 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+var (
+	typeTime     = reflect.TypeOf(time.Time{})
+	typeObjectId = reflect.TypeOf(bson.ObjectId(""))
+)
+
+// StorageJSONSchema 根据 json, binding 标签生成 Storage 的 JSON Schema
+func StorageJSONSchema() (data []byte, err error) {
+	schema := jsonSchema(reflect.TypeOf(Storage{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "Storage"
+	data, err = json.MarshalIndent(schema, "", "  ")
+	return
+}
+
+func jsonSchema(t reflect.Type) (schema map[string]interface{}) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == typeTime:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == typeObjectId:
+		return map[string]interface{}{"type": "string", "pattern": "^[0-9a-f]{24}$"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		schema = map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema = map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		schema = map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		schema = map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		schema = map[string]interface{}{"type": "object"}
+	case reflect.Struct:
+		schema = jsonSchemaStruct(t)
+	default:
+		schema = map[string]interface{}{}
+	}
+	return
+}
+
+func jsonSchemaStruct(t reflect.Type) (schema map[string]interface{}) {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Anonymous {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := jsonSchema(field.Type)
+		if jsonSchemaBinding(property, field.Tag.Get("binding")) {
+			required = append(required, name)
+		}
+		properties[name] = property
+	}
+	schema = map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) != 0 {
+		schema["required"] = required
+	}
+	return
+}
+
+// binding 的规则写入 schema, dive 之后的规则作用于数组的元素
+func jsonSchemaBinding(schema map[string]interface{}, binding string) (required bool) {
+	target := schema
+	dive := false
+	for _, rule := range strings.Split(binding, ",") {
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i != -1 {
+			name, param = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "required":
+			required = required || !dive
+		case "dive":
+			dive = true
+			if items, ok := target["items"].(map[string]interface{}); ok {
+				target = items
+			}
+		case "oneof":
+			target["enum"] = strings.Fields(param)
+		case "hexadecimal":
+			target["pattern"] = "^(0[xX])?[0-9a-fA-F]+$"
+		case "min", "max", "len":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			jsonSchemaLimit(target, name, n)
+		}
+	}
+	return
+}
+
+func jsonSchemaLimit(schema map[string]interface{}, name string, n float64) {
+	var keys []string
+	switch schema["type"] {
+	case "string":
+		keys = map[string][]string{"min": {"minLength"}, "max": {"maxLength"}, "len": {"minLength", "maxLength"}}[name]
+	case "array":
+		keys = map[string][]string{"min": {"minItems"}, "max": {"maxItems"}, "len": {"minItems", "maxItems"}}[name]
+	case "integer", "number":
+		keys = map[string][]string{"min": {"minimum"}, "max": {"maximum"}, "len": {"minimum", "maximum"}}[name]
+	}
+	for _, key := range keys {
+		schema[key] = n
+	}
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/otamoe/gin-server/errs"
+)
+
+var ErrStorageSearchEmpty = &errs.Error{
+	Message:    "Search query is empty",
+	Path:       "query",
+	Type:       "required",
+	StatusCode: http.StatusBadRequest,
+}
+
+// 使用 name 的 text 索引搜索, 按相关度排序
+func Search(ctx context.Context, query string, limit int) (storages []*Storage, err error) {
+	if query = strings.TrimSpace(query); query == "" {
+		err = ErrStorageSearchEmpty
+		return
+	}
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+	storages = []*Storage{}
+	err = ModelStorage.Query(ctx).
+		Find(map[string]interface{}{"$text": map[string]interface{}{"$search": query}}).
+		NeDeleted().
+		Fields(map[string]interface{}{"score": map[string]interface{}{"$meta": "textScore"}}).
+		Sort("$textScore:score").
+		Limit(limit).
+		All(&storages)
+	return
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"sync/atomic"
+)
+
+type (
+	// OriginSelector 返回源站的尝试顺序, 不能修改传入的 slice
+	OriginSelector interface {
+		Select(urls []string) []string
+	}
+
+	RoundRobinSelector struct {
+		next uint64
+	}
+)
+
+// nil 时始终按配置顺序
+var DefaultOriginSelector OriginSelector = &RoundRobinSelector{}
+
+func (selector *RoundRobinSelector) Select(urls []string) (values []string) {
+	n := len(urls)
+	if n < 2 {
+		return urls
+	}
+	start := int((atomic.AddUint64(&selector.next, 1) - 1) % uint64(n))
+	values = make([]string, 0, n)
+	values = append(values, urls[start:]...)
+	values = append(values, urls[:start]...)
+	return
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"context"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	mgoModel "github.com/otamoe/mgo-model"
+)
+
+// SaveInSession 使用调用方的 session 写入, 会执行 save, insert, update 事件和 version 检查
+// isNew 为 false 时按 _id 读取旧文档, 只 $set 修改的字段
+// globalsign/mgo 不支持 MongoDB 4.0 的多文档事务, 需要原子性的多文档写入请配合 mgo/txn 使用同一个 session
+func SaveInSession(ctx context.Context, sess *mgo.Session, storage *Storage, isNew bool) (err error) {
+	ctx = context.WithValue(ctx, mgoModel.CONTEXT, sess)
+	defer deleteCache(ctx, DefaultCache, storage.Unique)
+	if isNew {
+		if storage.ID == "" {
+			storage.ID = bson.NewObjectId()
+		}
+		storage.New(ctx, ModelStorage, storage, true)
+		if err = storage.Save(); err != nil {
+			return
+		}
+		storage.emitSave(ctx, nil)
+		return
+	}
+	old, ok := storage.Old.(*Storage)
+	if !ok {
+		old = &Storage{}
+		if err = ModelStorage.Query(ctx).ID(storage.ID).One(old); err != nil {
+			if err == mgo.ErrNotFound {
+				err = ErrStorageNotFound
+			}
+			return
+		}
+	}
+	storage.New(ctx, ModelStorage, storage, false)
+	storage.Old = old
+	if err = storage.Save(); err != nil {
+		return
+	}
+	storage.emitSave(ctx, old)
+	return
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	mgoModel "github.com/otamoe/mgo-model"
+)
+
+var sharedFetches = &sharedFetchGroup{fetches: map[string]*sharedFetch{}}
+
+// 加入 key 正在进行的回源, 没有时使用 start 开始新的回源
+// 回源不继承调用方的取消, 最后一个调用方离开或者到达调用方中最早的 deadline 时取消
+func (group *sharedFetchGroup) join(ctx context.Context, key string, timeout time.Duration, start func(ctx context.Context) (*Storage, bool, error)) (fetch *sharedFetch) {
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	fetch, ok := group.fetches[key]
+	if !ok {
+		// 第一个调用方关闭 session 不影响其他等待的调用方
+		fetchCtx := context.Context(detachedContext{ctx})
+		session, hasSession := ctx.Value(mgoModel.CONTEXT).(*mgo.Session)
+		if hasSession {
+			session = session.Copy()
+			fetchCtx = context.WithValue(fetchCtx, mgoModel.CONTEXT, session)
+		}
+		fetch = &sharedFetch{done: make(chan struct{})}
+		fetch.ctx, fetch.cancel = context.WithTimeout(fetchCtx, timeout)
+		group.fetches[key] = fetch
+		go func() {
+			defer close(fetch.done)
+			if hasSession {
+				defer session.Close()
+			}
+			defer fetch.cancel()
+			fetch.storage, fetch.fromCache, fetch.err = start(fetch.ctx)
+			group.mu.Lock()
+			if group.fetches[key] == fetch {
+				delete(group.fetches, key)
+			}
+			group.mu.Unlock()
+		}()
+	}
+	fetch.waiters++
+	if deadline, ok := ctx.Deadline(); ok && (fetch.deadline.IsZero() || deadline.Before(fetch.deadline)) {
+		fetch.deadline = deadline
+		if fetch.timer != nil {
+			fetch.timer.Stop()
+		}
+		fetch.timer = time.AfterFunc(time.Until(deadline), fetch.cancel)
+	}
+	return
+}
+
+// 调用方离开, 最后一个离开时取消回源
+func (group *sharedFetchGroup) leave(key string, fetch *sharedFetch) {
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	fetch.waiters--
+	if fetch.waiters > 0 {
+		return
+	}
+	if group.fetches[key] == fetch {
+		delete(group.fetches, key)
+	}
+	if fetch.timer != nil {
+		fetch.timer.Stop()
+	}
+	fetch.cancel()
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/otamoe/gin-server/errs"
+)
+
+// 签名方式:
+//  1. 在 Storage.URL() 后追加 expires=<unix 秒> 查询参数 (已有查询参数用 & 否则用 ?)
+//  2. signature = hex(HMAC-SHA256(secret, 第 1 步得到的完整 url))
+//  3. 最后追加 &signature=<signature>, signature 必须是最后一个参数
+var (
+	ErrSignedURLInvalid error = &errs.Error{
+		Message:    "Signed URL is invalid",
+		Path:       "signature",
+		Type:       "invalid",
+		StatusCode: http.StatusForbidden,
+	}
+
+	ErrSignedURLExpired error = &errs.Error{
+		Message:    "Signed URL has expired",
+		Path:       "expires",
+		Type:       "expired",
+		StatusCode: http.StatusForbidden,
+	}
+)
+
+func (storage *Storage) SignedURL(expires time.Time, secret []byte) (signedURL string, err error) {
+	if len(secret) == 0 {
+		err = errors.New("storage-model.SignedURL secret is required")
+		return
+	}
+	if signedURL, err = storage.URL(); err != nil {
+		return
+	}
+	if strings.Contains(signedURL, "?") {
+		signedURL += "&"
+	} else {
+		signedURL += "?"
+	}
+	signedURL += "expires=" + strconv.FormatInt(expires.Unix(), 10)
+	signedURL += "&signature=" + signURL(signedURL, secret)
+	return
+}
+
+func VerifySignedURL(rawurl string, secret []byte) (err error) {
+	if len(secret) == 0 {
+		err = errors.New("storage-model.VerifySignedURL secret is required")
+		return
+	}
+	index := strings.LastIndex(rawurl, "&signature=")
+	if index == -1 {
+		err = ErrSignedURLInvalid
+		return
+	}
+	payload := rawurl[:index]
+	signature := rawurl[index+len("&signature="):]
+	if !hmac.Equal([]byte(signURL(payload, secret)), []byte(strings.ToLower(signature))) {
+		err = ErrSignedURLInvalid
+		return
+	}
+
+	var u *url.URL
+	if u, err = url.Parse(payload); err != nil {
+		err = ErrSignedURLInvalid
+		return
+	}
+	var expires int64
+	if expires, err = strconv.ParseInt(u.Query().Get("expires"), 10, 64); err != nil {
+		err = ErrSignedURLInvalid
+		return
+	}
+	if time.Now().Unix() > expires {
+		err = ErrSignedURLExpired
+		return
+	}
+	return
+}
+
+func signURL(payload string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"context"
+	"net/http"
+)
+
+func IsStale(ctx context.Context, storage *Storage) (stale bool, err error) {
+	return defaultClient().IsStale(ctx, storage)
+}
+
+// 使用 ETag 或 UpdatedAt 发送条件 HEAD 请求, 源站返回 304 时未过期
+// 都没有的时候无法判断, 视为已过期
+func (client *Client) IsStale(ctx context.Context, storage *Storage) (stale bool, err error) {
+	var url string
+	var auth bool
+	if url, auth, err = client.url(storage.Unique); err != nil {
+		return
+	}
+
+	header := http.Header{}
+	if storage.ETag != "" {
+		header.Set("If-None-Match", storage.ETag)
+	} else if storage.UpdatedAt != nil {
+		header.Set("If-Modified-Since", storage.UpdatedAt.UTC().Format(http.TimeFormat))
+	} else {
+		stale = true
+		return
+	}
+
+	var res *http.Response
+	if res, err = client.head(ctx, url, auth, header); err != nil {
+		if _, ok := err.(*Error); !ok {
+			err = wrapError(ErrStorageServerError, err)
+		}
+		return
+	}
+	switch {
+	case res.StatusCode == http.StatusNotModified:
+	case res.StatusCode == http.StatusOK:
+		// 源站不支持条件请求时比较 ETag
+		stale = storage.ETag == "" || res.Header.Get("ETag") != storage.ETag
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden || res.StatusCode >= 500:
+		err = originStatusError(res)
+	default:
+		stale = true
+	}
+	return
+}
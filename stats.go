@@ -0,0 +1,51 @@
+package model
+
+import (
+	"sync/atomic"
+)
+
+type (
+	StatsSnapshot struct {
+		CacheHits         int64 `json:"cache_hits"`
+		CacheMisses       int64 `json:"cache_misses"`
+		NegativeCacheHits int64 `json:"negative_cache_hits"`
+		OriginFetches     int64 `json:"origin_fetches"`
+		InFlightFetches   int64 `json:"in_flight_fetches"`
+
+		// LRUCache 命中率, 没有请求时为 0
+		LRUHits    int64   `json:"lru_hits"`
+		LRUMisses  int64   `json:"lru_misses"`
+		LRUHitRate float64 `json:"lru_hit_rate"`
+
+		// 源站熔断状态 scheme://host => closed, open, half_open
+		Breakers map[string]string `json:"breakers,omitempty"`
+	}
+)
+
+var stats StatsSnapshot
+
+func Stats() (snapshot StatsSnapshot) {
+	snapshot = StatsSnapshot{
+		CacheHits:         atomic.LoadInt64(&stats.CacheHits),
+		CacheMisses:       atomic.LoadInt64(&stats.CacheMisses),
+		NegativeCacheHits: atomic.LoadInt64(&stats.NegativeCacheHits),
+		OriginFetches:     atomic.LoadInt64(&stats.OriginFetches),
+		InFlightFetches:   atomic.LoadInt64(&stats.InFlightFetches),
+		LRUHits:           atomic.LoadInt64(&stats.LRUHits),
+		LRUMisses:         atomic.LoadInt64(&stats.LRUMisses),
+		Breakers:          breakers.states(),
+	}
+	if total := snapshot.LRUHits + snapshot.LRUMisses; total != 0 {
+		snapshot.LRUHitRate = float64(snapshot.LRUHits) / float64(total)
+	}
+	return
+}
+
+func ResetStats() {
+	atomic.StoreInt64(&stats.CacheHits, 0)
+	atomic.StoreInt64(&stats.CacheMisses, 0)
+	atomic.StoreInt64(&stats.NegativeCacheHits, 0)
+	atomic.StoreInt64(&stats.OriginFetches, 0)
+	atomic.StoreInt64(&stats.LRUHits, 0)
+	atomic.StoreInt64(&stats.LRUMisses, 0)
+}
@@ -2,55 +2,177 @@ package model
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"io/ioutil"
+	"fmt"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 	"github.com/otamoe/gin-server/errs"
 	mgoModel "github.com/otamoe/mgo-model"
-	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
+	GetOptions struct {
+		// 优先读取缓存
+		Cache bool
+		// 回源结果写入缓存
+		Save bool
+		// 缓存包含已软删除的文档
+		IncludeDeleted bool
+		// 覆盖回源超时, 0 使用 client 的配置
+		Timeout time.Duration
+		// 只返回属于 Owner 的文件, 空时读取 context 的 CONTEXT_OWNER
+		// 回源保存时作为没有 owner 的文件的 Owner
+		Owner bson.ObjectId
+		// 只返回 approved 的文件, banned 返回 ErrStorageBanned, 其他状态返回 ErrStorageNotFound
+		// 缓存和回源的结果都会检查, 不影响写入缓存
+		RequireApproved bool
+	}
+
+	DeleteOptions struct {
+		// 同时软删除所有衍生文件, 包括衍生文件的衍生文件
+		Cascade bool
+	}
+
+	getRequest struct {
+		val    string
+		urls   []string
+		auth   bool
+		cached *Storage
+		save   bool
+		owner  bson.ObjectId
+	}
+
+	// Get 结果的来源
+	ResultMeta struct {
+		// 结果来自缓存 (包含 304 和 stale-if-error)
+		FromCache bool
+		// 缓存的 UpdatedAt 距今时间
+		Age time.Duration
+		// 回源耗时, 命中缓存时为 0
+		FetchDuration time.Duration
+	}
+
+	// 正在后台刷新的 url
+	revalidateGroup struct {
+		mu   sync.Mutex
+		urls map[string]bool
+	}
+
+	// 合并中的回源, 所有调用方离开时取消
+	sharedFetch struct {
+		ctx     context.Context
+		cancel  context.CancelFunc
+		done    chan struct{}
+		waiters int
+		// 调用方中最早的 deadline
+		deadline time.Time
+		timer    *time.Timer
+
+		storage   *Storage
+		fromCache bool
+		err       error
+	}
+
+	sharedFetchGroup struct {
+		mu      sync.Mutex
+		fetches map[string]*sharedFetch
+	}
+
 	Storage struct {
-		mgoModel.DocumentBase `json:"-" bson:"-" binding:"-"`
-		ID                    bson.ObjectId `json:"_id" bson:"_id" binding:"required,objectid"`
+		mgoModel.DocumentBase `json:"-" msgpack:"-" bson:"-" binding:"-"`
+		ID                    bson.ObjectId `json:"_id" msgpack:"_id" bson:"_id" binding:"required,objectid"`
+
+		Unique string `json:"unique" msgpack:"unique" bson:"unique" binding:"required"`
+
+		Path string `json:"path" msgpack:"path" bson:"path" binding:"required"`
+
+		HLS string `json:"hls,omitempty" msgpack:"hls,omitempty" bson:"hls,omitempty"`
+		// 配置 HLSKeyEncryptionKey 时加密储存
+		HLSKey EncryptedString `json:"hls_key,omitempty" msgpack:"hls_key,omitempty" bson:"hls_key,omitempty"`
 
-		Unique string `json:"unique" bson:"unique" binding:"required"`
+		DASH    string          `json:"dash,omitempty" msgpack:"dash,omitempty" bson:"dash,omitempty"`
+		DASHKey EncryptedString `json:"dash_key,omitempty" msgpack:"dash_key,omitempty" bson:"dash_key,omitempty"`
 
-		Path string `json:"path" bson:"path" binding:"required"`
+		// json 输出 HLSKey, DASHKey
+		IncludeHLSKey bool `json:"-" msgpack:"-" bson:"-"`
 
-		HLS    string `json:"hls,omitempty" bson:"hls,omitempty"`
-		HLSKey string `json:"hls_key,omitempty" bson:"hls_key,omitempty"`
+		Status  string `json:"status,omitempty" msgpack:"status,omitempty" bson:"status" binding:"required,oneof=pending approved unapproved banned"`
+		Name    string `json:"name,omitempty" msgpack:"name,omitempty" bson:"name" binding:"omitempty,max=512"`
+		Type    string `json:"type,omitempty" msgpack:"type,omitempty" bson:"type" binding:"omitempty,max=32"`
+		SubType string `json:"sub_type,omitempty" msgpack:"sub_type,omitempty" bson:"sub_type" binding:"omitempty,max=64"`
 
-		Status  string `json:"status,omitempty" bson:"status" binding:"required,oneof=pending approved unapproved banned"`
-		Name    string `json:"name,omitempty" bson:"name" binding:"omitempty,max=512"`
-		Type    string `json:"type,omitempty" bson:"type" binding:"omitempty,max=32"`
-		SubType string `json:"sub_type,omitempty" bson:"sub_type" binding:"omitempty,max=64"`
+		Size     int64                  `json:"size,omitempty" msgpack:"size,omitempty" bson:"size" binding:"omitempty,min=0"`
+		Duration float64                `json:"duration,omitempty" msgpack:"duration,omitempty" bson:"duration,omitempty" binding:"omitempty,min=0,max=2592000"`
+		Width    int                    `json:"width,omitempty" msgpack:"width,omitempty" bson:"width,omitempty" binding:"omitempty,min=0,max=32767"`
+		Height   int                    `json:"height,omitempty" msgpack:"height,omitempty" bson:"height,omitempty" binding:"omitempty,min=0,max=32767"`
+		Pixels   int                    `json:"pixels,omitempty" msgpack:"pixels,omitempty" bson:"pixels,omitempty" binding:"omitempty,min=0,max=268435456"`
+		Meta     map[string]interface{} `json:"meta,omitempty" msgpack:"meta,omitempty" bson:"meta,omitempty"`
 
-		Size     int64                  `json:"size,omitempty" bson:"size" binding:"omitempty,min=0"`
-		Duration float64                `json:"duration,omitempty" bson:"duration,omitempty" binding:"omitempty,min=0,max=2592000"`
-		Width    int                    `json:"width,omitempty" bson:"width,omitempty" binding:"omitempty,min=0,max=32767"`
-		Height   int                    `json:"height,omitempty" bson:"height,omitempty" binding:"omitempty,min=0,max=32767"`
-		Pixels   int                    `json:"pixels,omitempty" bson:"pixels,omitempty" binding:"omitempty,min=0,max=268435456"`
-		Meta     map[string]interface{} `json:"meta,omitempty" bson:"meta,omitempty"`
+		Variants []Variant `json:"variants,omitempty" msgpack:"variants,omitempty" bson:"variants,omitempty" binding:"omitempty,dive"`
 
-		Complete bool `json:"complete,omitempty" bson:"complete"`
+		Subtitles   []Track `json:"subtitles,omitempty" msgpack:"subtitles,omitempty" bson:"subtitles,omitempty" binding:"omitempty,dive"`
+		AudioTracks []Track `json:"audio_tracks,omitempty" msgpack:"audio_tracks,omitempty" bson:"audio_tracks,omitempty" binding:"omitempty,dive"`
 
-		CreatedAt *time.Time `json:"created_at,omitempty" bson:"created_at" binding:"required"`
-		UpdatedAt *time.Time `json:"updated_at,omitempty" bson:"updated_at" binding:"required"`
-		DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+		Complete bool `json:"complete,omitempty" msgpack:"complete,omitempty" bson:"complete"`
 
-		Errors     []*errs.Error `json:"errors,omitempty" bson:"errors,omitempty"`
-		StatusCode int           `json:"status_code,omitempty" bson:"status_code,omitempty"`
+		Version int64 `json:"version,omitempty" msgpack:"version,omitempty" bson:"version"`
+
+		ETag   string `json:"etag,omitempty" msgpack:"etag,omitempty" bson:"etag,omitempty"`
+		SHA256 string `json:"sha256,omitempty" msgpack:"sha256,omitempty" bson:"sha256,omitempty" binding:"omitempty,hexadecimal,len=64"`
+
+		// Dedup 开启时, 第一个文件的引用计数, 重复的文件 Blob 指向第一个文件
+		RefCount  int           `json:"ref_count,omitempty" msgpack:"ref_count,omitempty" bson:"ref_count,omitempty"`
+		Blob      bson.ObjectId `json:"blob,omitempty" msgpack:"blob,omitempty" bson:"blob,omitempty"`
+		PendingGC bool          `json:"pending_gc,omitempty" msgpack:"pending_gc,omitempty" bson:"pending_gc,omitempty"`
+
+		// 衍生文件的原文件
+		Parent bson.ObjectId `json:"parent,omitempty" msgpack:"parent,omitempty" bson:"parent,omitempty"`
+
+		// unique 索引是全局的, 同一个 unique 只能属于一个 owner
+		Owner bson.ObjectId `json:"owner,omitempty" msgpack:"owner,omitempty" bson:"owner,omitempty"`
+
+		Tags []string `json:"tags,omitempty" msgpack:"tags,omitempty" bson:"tags,omitempty"`
+
+		CreatedAt *time.Time `json:"created_at,omitempty" msgpack:"created_at,omitempty" bson:"created_at" binding:"required"`
+		UpdatedAt *time.Time `json:"updated_at,omitempty" msgpack:"updated_at,omitempty" bson:"updated_at" binding:"required"`
+		DeletedAt *time.Time `json:"deleted_at,omitempty" msgpack:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+		// 源站 Cache-Control max-age 计算的过期时间, 为空时使用 CacheTTL
+		ExpiresAt *time.Time `json:"expires_at,omitempty" msgpack:"expires_at,omitempty" bson:"expires_at,omitempty"`
+
+		Errors     []*errs.Error `json:"errors,omitempty" msgpack:"errors,omitempty" bson:"errors,omitempty"`
+		StatusCode int           `json:"status_code,omitempty" msgpack:"status_code,omitempty" bson:"status_code,omitempty"`
+
+		// HLS, DASH 解析失败等不影响回源结果的错误, 不包含在 Err() 中
+		Warnings []*errs.Error `json:"warnings,omitempty" msgpack:"warnings,omitempty" bson:"warnings,omitempty"`
+
+		// 第一个错误的原始值, 见 Err()
+		err error `json:"-" msgpack:"-" bson:"-"`
+
+		// dedup 已增加引用计数, 插入失败时归还, dedupPath 为之前的 Path
+		deduped   bool   `json:"-" msgpack:"-" bson:"-"`
+		dedupPath string `json:"-" msgpack:"-" bson:"-"`
 	}
 )
 
+// 和 Storage.Status 的 binding oneof 一致
+const (
+	StatusPending    = "pending"
+	StatusApproved   = "approved"
+	StatusUnapproved = "unapproved"
+	StatusBanned     = "banned"
+)
+
 var (
 	ErrStorageNotFound error = &errs.Error{
 		Message:    "File not found",
@@ -59,6 +181,65 @@ var (
 		StatusCode: http.StatusNotFound,
 	}
 
+	ErrStorageNotDeleted error = &errs.Error{
+		Message:    "File not deleted",
+		Path:       "storage",
+		Type:       "not_deleted",
+		StatusCode: http.StatusConflict,
+	}
+
+	ErrStorageRateLimited = &errs.Error{
+		Message:    "Storage: Rate limited",
+		Path:       "storage",
+		Type:       "rate_limited",
+		StatusCode: http.StatusTooManyRequests,
+	}
+
+	ErrStorageResponseTooLarge error = &errs.Error{
+		Message:    "Storage: Response body too large",
+		Path:       "storage",
+		Type:       "too_large",
+		StatusCode: http.StatusBadGateway,
+	}
+
+	ErrStorageChecksum error = &errs.Error{
+		Message:    "Storage: Checksum mismatch",
+		Path:       "sha256",
+		Type:       "checksum",
+		StatusCode: http.StatusBadGateway,
+	}
+
+	// 451 Unavailable For Legal Reasons, GetOptions.RequireApproved 时返回
+	ErrStorageBanned = &errs.Error{
+		Message:    "File is unavailable for legal reasons",
+		Path:       "storage",
+		Type:       "banned",
+		StatusCode: http.StatusUnavailableForLegalReasons,
+	}
+
+	ErrStorageStatusTransition = &errs.Error{
+		Message:    "Status transition is not allowed",
+		Path:       "status",
+		Type:       "transition",
+		StatusCode: http.StatusBadRequest,
+	}
+
+	// Complete 时 pending 转换的状态, 空不修改
+	CompleteStatus string
+
+	// 源站没有返回 status 时使用的状态
+	DefaultStatus = StatusPending
+	// 为 true 时源站必须返回 status, 不使用 DefaultStatus
+	StrictStatus bool
+
+	// 允许的状态转换 from => []to, banned 默认为终态
+	StatusTransitions = map[string][]string{
+		StatusPending:    []string{StatusApproved, StatusUnapproved, StatusBanned},
+		StatusApproved:   []string{StatusUnapproved, StatusBanned},
+		StatusUnapproved: []string{StatusApproved, StatusBanned},
+		StatusBanned:     []string{},
+	}
+
 	ModelStorage = &mgoModel.Model{
 		Name:     "storages",
 		Document: &Storage{},
@@ -68,148 +249,697 @@ var (
 				Unique:     true,
 				Background: true,
 			},
+			// status 前缀查询同样可以使用
+			mgo.Index{
+				Key:        []string{"status", "deleted_at"},
+				Background: true,
+			},
+			// 按创建时间倒序列出 sort("-created_at") 和 created_at 范围查询
+			mgo.Index{
+				Key:        []string{"-created_at"},
+				Background: true,
+			},
+			mgo.Index{
+				Key:        []string{"owner", "-created_at"},
+				Background: true,
+			},
+			// Search 使用
+			mgo.Index{
+				Key:        []string{"$text:name"},
+				Background: true,
+			},
+			// Derivatives 使用
+			mgo.Index{
+				Key:        []string{"parent"},
+				Background: true,
+				Sparse:     true,
+			},
+			// Dedup 查找相同的文件
+			mgo.Index{
+				Key:        []string{"sha256"},
+				Background: true,
+				Sparse:     true,
+			},
+			// 数组字段 multikey 索引
+			mgo.Index{
+				Key:        []string{"tags"},
+				Background: true,
+			},
+			// eq("status").sort("-created_at") 例如最近待审核的
+			mgo.Index{
+				Key:        []string{"status", "-created_at"},
+				Background: true,
+			},
 		},
 	}
 )
 
 func Get(ctx context.Context, val string, cache bool, save bool) (storage *Storage, err error) {
-	val2 := strings.Split(val, "/")
-	var url string
+	return defaultClient().Get(ctx, val, cache, save)
+}
+
+func GetWithOptions(ctx context.Context, val string, opts GetOptions) (storage *Storage, err error) {
+	return defaultClient().GetWithOptions(ctx, val, opts)
+}
+
+func GetWithMeta(ctx context.Context, val string, opts GetOptions) (storage *Storage, meta ResultMeta, err error) {
+	return defaultClient().GetWithMeta(ctx, val, opts)
+}
+
+func Refresh(ctx context.Context, val string) (storage *Storage, err error) {
+	return defaultClient().Refresh(ctx, val)
+}
+
+// Refresh 忽略缓存强制回源并覆盖缓存, 保留原来的 _id
+func (client *Client) Refresh(ctx context.Context, val string) (storage *Storage, err error) {
+	client.deleteCache(ctx, val)
+	return client.GetWithOptions(ctx, val, GetOptions{Save: true})
+}
+
+func (client *Client) Get(ctx context.Context, val string, cache bool, save bool) (storage *Storage, err error) {
+	return client.GetWithOptions(ctx, val, GetOptions{Cache: cache, Save: save})
+}
+
+func (client *Client) GetWithOptions(ctx context.Context, val string, opts GetOptions) (storage *Storage, err error) {
+	storage, _, err = client.GetWithMeta(ctx, val, opts)
+	return
+}
+
+func (client *Client) GetWithMeta(ctx context.Context, val string, opts GetOptions) (storage *Storage, meta ResultMeta, err error) {
+	var span trace.Span
+	ctx, span = tracer.Start(ctx, "storage.Get", trace.WithAttributes(
+		attribute.String("unique", val),
+		attribute.Bool("cache", opts.Cache),
+		attribute.Bool("save", opts.Save),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	if opts.RequireApproved {
+		defer func() {
+			if err == nil && storage != nil {
+				if err = storage.requireApproved(); err != nil {
+					storage = nil
+				}
+			}
+		}()
+	}
+
+	var urls []string
 	var auth bool
+	if urls, auth, err = client.urls(val); err != nil {
+		return
+	}
+	if opts.Timeout > 0 {
+		ctx = context.WithValue(ctx, CONTEXT_FETCH_TIMEOUT, opts.Timeout)
+	}
+	owner := opts.Owner
+	if owner == "" {
+		owner = contextOwner(ctx)
+	}
+
+	var cached *Storage
+	if opts.Cache {
+		var ok bool
+		if cached, ok = client.getCache().Get(ctx, val); !ok {
+			cached = nil
+		} else if (cached.DeletedAt != nil && !opts.IncludeDeleted && !includeDeleted(ctx)) || !cached.isOwner(owner) {
+			// 已软删除或者属于其他 owner 的视为不存在, 不回源以免和 unique 索引冲突
+			atomic.AddInt64(&stats.CacheHits, 1)
+			DefaultMetrics.IncCache(true)
+			meta.FromCache = true
+			meta.Age = cached.age()
+			storage = nil
+			err = ErrStorageNotFound
+			return
+		} else if !cached.isNegativeExpired() && (!cached.isStale() || (opts.Save && client.revalidate(ctx, val, urls, auth, cached, owner))) {
+			storage = cached
+			DefaultMetrics.IncCache(true)
+			meta.FromCache = true
+			meta.Age = cached.age()
+			if storage.isNegative() {
+				atomic.AddInt64(&stats.NegativeCacheHits, 1)
+				err = ErrStorageNotFound
+			} else {
+				atomic.AddInt64(&stats.CacheHits, 1)
+				err = storage.Err()
+			}
+			return
+		}
+		atomic.AddInt64(&stats.CacheMisses, 1)
+		DefaultMetrics.IncCache(false)
+	}
+	err = nil
+	start := time.Now()
+	storage, meta.FromCache, err = client.getShared(ctx, &getRequest{
+		val:    val,
+		urls:   urls,
+		auth:   auth,
+		cached: cached,
+		save:   opts.Save,
+		owner:  owner,
+	})
+	meta.FetchDuration = time.Since(start)
+	if meta.FromCache && storage != nil {
+		meta.Age = storage.age()
+	}
+	return
+}
+
+func (client *Client) url(val string) (url string, auth bool, err error) {
+	var urls []string
+	if urls, auth, err = client.urls(val); err != nil {
+		return
+	}
+	url = urls[0]
+	return
+}
+
+// object id 对使用 StorageOrigin, 其他按路径使用 StoragePathOrigin 并需要认证
+// 返回每个源站的 url, 第一个为规范的 url
+func (client *Client) urls(val string) (urls []string, auth bool, err error) {
+	val2 := strings.Split(val, "/")
 	if len(val2) == 2 && bson.IsObjectIdHex(val2[0]) && bson.IsObjectIdHex(val2[1]) {
-		if StorageOrigin == "" {
+		if len(client.storageOrigins) == 0 {
 			err = errors.New("storage-model.StorageOrigin is required")
 			return
 		}
-		url = StorageOrigin + "/" + val + "/"
+		for _, origin := range client.storageOrigins {
+			urls = append(urls, origin+"/"+val+"/")
+		}
+		return
+	}
+	if len(client.storagePathOrigins) == 0 {
+		err = ErrStorageNotFound
+		return
+	}
+	var path string
+	if path, err = encodePath(val); err != nil {
+		return
+	}
+	for _, origin := range client.storagePathOrigins {
+		urls = append(urls, origin+"/"+path)
+	}
+	auth = true
+	return
+}
+
+// 按 OriginSelector 排序后截取 maxOriginAttempts 个
+func (client *Client) selectOrigins(urls []string) []string {
+	if client.originSelector != nil && len(urls) > 1 {
+		urls = client.originSelector.Select(urls)
+	}
+	if client.maxOriginAttempts > 0 && len(urls) > client.maxOriginAttempts {
+		urls = urls[:client.maxOriginAttempts]
+	}
+	return urls
+}
+
+// 合并相同 url 的并发回源, save 也只执行一次
+func (client *Client) getShared(ctx context.Context, req *getRequest) (storage *Storage, fromCache bool, err error) {
+	key := req.urls[0] + "\x00" + string(req.owner)
+	if req.save {
+		key += "\x00save"
+	}
+	fetch := sharedFetches.join(ctx, key, client.fetchTimeout(ctx), func(ctx context.Context) (*Storage, bool, error) {
+		return client.getOrigin(ctx, req)
+	})
+	defer sharedFetches.leave(key, fetch)
+	select {
+	case <-ctx.Done():
+		err = contextError(ctx, ctx.Err())
+	case <-fetch.done:
+		// 回源因为调用方的 deadline 取消时和 ctx.Done 同时发生
+		if ctx.Err() != nil {
+			err = contextError(ctx, ctx.Err())
+			return
+		}
+		if fetch.storage != nil {
+			clone := *fetch.storage
+			storage = &clone
+			fromCache = fetch.fromCache
+			// 共享的 session 已经关闭, 使用调用方的 ctx
+			if storage.Model != nil {
+				storage.New(ctx, ModelStorage, storage, storage.IsNew)
+			}
+		}
+		err = fetch.err
+	}
+	return
+}
+
+func (client *Client) getOrigin(ctx context.Context, req *getRequest) (storage *Storage, fromCache bool, err error) {
+	cached := req.cached
+	save := req.save
+	var etag string
+	if cached != nil && !cached.isNegative() {
+		etag = cached.ETag
+	}
+	urls := client.selectOrigins(req.urls)
+	if fetcher := client.getFetcher(); fetcher != nil {
+		var e error
+		if storage, e = fetcher.Fetch(ctx, urls[0], req.auth); storage == nil {
+			storage = &Storage{}
+		}
+		if e != nil && len(storage.Errors) == 0 {
+			storage.addError(e)
+		}
 	} else {
-		if StoragePathOrigin == "" {
+		storage = client.fetch(ctx, urls, req.auth, etag)
+	}
+	storage.Unique = req.val
+
+	if len(storage.Errors) == 0 {
+		// 源站没有返回 owner 时按已储存的文档检查, 写入时由 save 补全
+		owner := storage.Owner
+		if owner == "" && cached != nil && !cached.isNegative() {
+			owner = cached.Owner
+		}
+		if owner != "" && req.owner != "" && owner != req.owner {
+			storage = nil
 			err = ErrStorageNotFound
 			return
 		}
-		url = StoragePathOrigin + "/" + val
-		auth = true
-		for _, val := range val2 {
-			if val == "" || strings.TrimSpace(val) != val || val[0] == '.' || strings.ContainsAny(val, "/:*?#%&<>\\") {
-				err = ErrStorageNotFound
+		// 不符合 binding 规则的回源结果不写入缓存
+		if storage.StatusCode != http.StatusNotModified {
+			if e := storage.normalize(); e != nil {
+				storage.addError(e)
+			} else if e := storage.validate(); e != nil {
+				storage.addError(e)
+			}
+		}
+	}
+
+	// HLS, DASH 解析失败不影响回源结果, 记录到 Warnings
+	if len(storage.Errors) == 0 && storage.StatusCode != http.StatusNotModified {
+		if ParseHLS && storage.HLS != "" {
+			if e := client.parseHLS(ctx, storage); e != nil {
+				storage.Warnings = append(storage.Warnings, toError(e))
+			}
+		}
+		if ParseDASH && storage.DASH != "" {
+			if e := client.parseDASH(ctx, storage); e != nil {
+				storage.Warnings = append(storage.Warnings, toError(e))
+			}
+		}
+	}
+
+	// 304 源站未修改, 沿用缓存只刷新 UpdatedAt, ExpiresAt
+	if storage.StatusCode == http.StatusNotModified && cached != nil {
+		expiresAt := storage.ExpiresAt
+		storage = cached
+		fromCache = true
+		storage.edit(ctx)
+		now := time.Now()
+		storage.UpdatedAt = &now
+		storage.ExpiresAt = expiresAt
+		if save {
+			if err = storage.Save(); err != nil {
 				return
 			}
+			client.getCache().Set(ctx, req.val, storage)
 		}
+		return
 	}
-	storage = &Storage{}
-	if cache {
-		if err = ModelStorage.Query(ctx).Eq("unique", val).One(storage); err != mgo.ErrNotFound {
-			if len(storage.Errors) != 0 {
-				err = storage.Errors[0]
+
+	// stale-if-error 重新拉取失败时返回过期的缓存
+	if cached != nil && !cached.isNegative() && len(storage.Errors) != 0 && !storage.isNegative() {
+		storage = cached
+		fromCache = true
+		err = storage.Err()
+		return
+	}
+
+	if save && storage.isCacheable() {
+		// 404 的缓存到期时间, 开启 TTL 索引时由 mongodb 删除
+		if storage.isNegative() {
+			expiresAt := time.Now().Add(NegativeCacheTTL).UTC()
+			storage.ExpiresAt = &expiresAt
+		}
+		// 其他缓存后端和从节点读取的文档不一定和主节点一致, 由 save 重新查询
+		old := cached
+		if cache, ok := client.getCache().(MongoCache); !ok || cache.Mode != 0 {
+			old = nil
+		}
+		if err = storage.save(ctx, old, req.owner); err != nil {
+			if err == ErrStorageNotFound {
+				storage = nil
 			}
 			return
 		}
+		client.getCache().Set(ctx, req.val, storage)
 	}
-	err = nil
-	if storage.Unique == "" {
-		storage = fetch(url, auth)
-		storage.Unique = val
+	err = storage.Err()
+	return
+}
+
+func Delete(ctx context.Context, val string) (err error) {
+	return defaultClient().Delete(ctx, val)
+}
+
+func DeleteWithOptions(ctx context.Context, val string, opts DeleteOptions) (err error) {
+	return defaultClient().DeleteWithOptions(ctx, val, opts)
+}
+
+func (client *Client) Delete(ctx context.Context, val string) (err error) {
+	return client.DeleteWithOptions(ctx, val, DeleteOptions{})
+}
+
+// 删除之后清除 client 的缓存
+func (client *Client) DeleteWithOptions(ctx context.Context, val string, opts DeleteOptions) (err error) {
+	defer client.deleteCache(ctx, val)
+	storage := &Storage{}
+	if err = ModelStorage.Query(ctx).Eq("unique", val).NeDeleted().One(storage); err != nil {
+		if err == mgo.ErrNotFound {
+			err = ErrStorageNotFound
+		}
+		return
 	}
+	if opts.Cascade {
+		// 先删除衍生文件, 失败时不删除原文件, 避免留下没有原文件的衍生文件
+		if err = deleteDerivatives(ctx, client.getCache(), storage.ID); err != nil {
+			return
+		}
+	}
+	storage.New(ctx, ModelStorage, storage, false)
+	if err = storage.Delete(); err != nil {
+		if err == mgo.ErrNotFound {
+			err = ErrStorageNotFound
+		}
+		return
+	}
+	emitChange(ctx, ChangeEvent{Unique: val, Kind: ChangeDelete, Status: storage.Status, OldStatus: storage.Status, Storage: storage})
+	purgeCDN(ctx, storage)
+	err = releaseBlob(ctx, storage)
+	return
+}
+
+func Restore(ctx context.Context, val string) (err error) {
+	return defaultClient().Restore(ctx, val)
+}
 
-	if save {
-		var isNew bool
-		if cache {
-			isNew = true
-		} else if err = ModelStorage.Query(ctx).Eq("unique", val).One(storage); err == mgo.ErrNotFound {
-			isNew = true
+func (client *Client) Restore(ctx context.Context, val string) (err error) {
+	defer client.deleteCache(ctx, val)
+	storage := &Storage{}
+	if err = ModelStorage.Query(ctx).Eq("unique", val).One(storage); err != nil {
+		if err == mgo.ErrNotFound {
+			err = ErrStorageNotFound
+		}
+		return
+	}
+	if storage.DeletedAt == nil {
+		err = ErrStorageNotDeleted
+		return
+	}
+	storage.New(ctx, ModelStorage, storage, false)
+	if err = storage.Restore(); err != nil {
+		if err == mgo.ErrNotFound {
+			err = ErrStorageNotDeleted
 		}
-		if isNew {
-			storage.ID = bson.NewObjectId()
+		return
+	}
+	emitChange(ctx, ChangeEvent{Unique: val, Kind: ChangeRestore, Status: storage.Status, OldStatus: storage.Status, Storage: storage})
+	err = retainBlob(ctx, storage)
+	return
+}
+
+func UpdateStatus(ctx context.Context, val, newStatus string) (err error) {
+	return defaultClient().UpdateStatus(ctx, val, newStatus)
+}
+
+func (client *Client) UpdateStatus(ctx context.Context, val, newStatus string) (err error) {
+	defer client.deleteCache(ctx, val)
+	storage := &Storage{}
+	if err = ModelStorage.Query(ctx).Eq("unique", val).NeDeleted().One(storage); err != nil {
+		if err == mgo.ErrNotFound {
+			err = ErrStorageNotFound
 		}
-		storage.New(ctx, ModelStorage, storage, isNew)
+		return
 	}
-	if len(storage.Errors) != 0 {
-		err = storage.Errors[0]
+	if storage.Status == newStatus {
+		return
+	}
+	if !canTransition(storage.Status, newStatus) {
+		ginErr := ErrStorageStatusTransition.Clone()
+		ginErr.Message = fmt.Sprintf("Status transition from %q to %q is not allowed", storage.Status, newStatus)
+		ginErr.Value = newStatus
+		ginErr.Params = map[string]interface{}{"from": storage.Status, "to": newStatus}
+		err = ginErr
+		return
+	}
+	oldStatus := storage.Status
+	storage.edit(ctx)
+	storage.Status = newStatus
+	if err = storage.Save(); err != nil {
+		return
+	}
+	emitChange(ctx, ChangeEvent{Unique: val, Kind: ChangeStatus, Status: newStatus, OldStatus: oldStatus, Storage: storage})
+	if newStatus == StatusBanned {
+		purgeCDN(ctx, storage)
 	}
 	return
 }
 
-func fetch(url string, auth bool) (storage *Storage) {
+func Touch(ctx context.Context, val string) (err error) {
+	return defaultClient().Touch(ctx, val)
+}
+
+// Touch 只更新 UpdatedAt, 不回源
+func (client *Client) Touch(ctx context.Context, val string) (err error) {
+	defer client.deleteCache(ctx, val)
+	update := bson.M{"$set": bson.M{"updated_at": time.Now().UTC()}}
+	if err = ModelStorage.Query(ctx).Eq("unique", val).NeDeleted().Update(update); err == mgo.ErrNotFound {
+		err = ErrStorageNotFound
+	}
+	return
+}
 
-	var err error
-	storage = &Storage{}
+func Complete(ctx context.Context, val string) (err error) {
+	return defaultClient().Complete(ctx, val)
+}
 
-	defer func() {
-		if err == nil {
+// Complete 标记上传完成, status 为 pending 且配置了 CompleteStatus 时在同一次更新中修改 status
+// 没有状态可以转换为 pending, 条件更新不匹配时只标记完成
+func (client *Client) Complete(ctx context.Context, val string) (err error) {
+	defer client.deleteCache(ctx, val)
+	now := time.Now().UTC()
+	if CompleteStatus != "" && canTransition(StatusPending, CompleteStatus) {
+		update := bson.M{
+			"$set": bson.M{"complete": true, "status": CompleteStatus, "updated_at": now},
+			"$inc": bson.M{"version": 1},
+		}
+		if err = ModelStorage.Query(ctx).Eq("unique", val).Eq("status", StatusPending).NeDeleted().Update(update); err == nil {
+			emitChange(ctx, ChangeEvent{Unique: val, Kind: ChangeStatus, Status: CompleteStatus, OldStatus: StatusPending})
 			return
 		}
-		var ginErr *errs.Error
-		switch err.(type) {
-		case *errs.Error:
-			ginErr = err.(*errs.Error)
-			if ginErr.Err != nil {
-				ginErr.Message = ginErr.Err.Error()
-				ginErr.Err = nil
-			}
-		default:
-			ginErr = &errs.Error{
-				Message: err.Error(),
-			}
+		if err != mgo.ErrNotFound {
+			return
 		}
+	}
+	update := bson.M{
+		"$set": bson.M{"complete": true, "updated_at": now},
+		"$inc": bson.M{"version": 1},
+	}
+	if err = ModelStorage.Query(ctx).Eq("unique", val).NeDeleted().Update(update); err == mgo.ErrNotFound {
+		err = ErrStorageNotFound
+	}
+	return
+}
 
-		storage.Errors = append(storage.Errors, ginErr)
-		if storage.StatusCode != 0 {
+func (storage *Storage) IsPending() bool {
+	return storage.Status == StatusPending
+}
 
-		} else if ginErr.StatusCode != 0 {
-			storage.StatusCode = ginErr.StatusCode
-		} else {
-			storage.StatusCode = http.StatusInternalServerError
-		}
-	}()
-	var res *http.Response
-	var bodyBytes []byte
+func (storage *Storage) IsApproved() bool {
+	return storage.Status == StatusApproved
+}
 
-	client := &http.Client{}
+func (storage *Storage) IsUnapproved() bool {
+	return storage.Status == StatusUnapproved
+}
 
-	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), time.Second*20)
-	defer timeoutCancel()
+func (storage *Storage) IsBanned() bool {
+	return storage.Status == StatusBanned
+}
 
-	var req *http.Request
-	if req, err = http.NewRequest("GET", url, nil); err != nil {
+// approved 返回 nil, banned 返回 ErrStorageBanned, pending, unapproved 等返回 ErrStorageNotFound
+func (storage *Storage) requireApproved() (err error) {
+	switch storage.Status {
+	case StatusApproved:
+	case StatusBanned:
+		// 带上 unique 方便记录日志, errors.Is(err, ErrStorageBanned) 仍然成立
+		wrapped := wrapError(ErrStorageBanned, nil)
+		wrapped.GinError.Value = storage.Unique
+		wrapped.GinError.Params = map[string]interface{}{"unique": storage.Unique}
+		err = wrapped
+	default:
 		err = ErrStorageNotFound
-		return
 	}
-	if auth {
-		if Username == "" {
-			err = errors.New("storage-model.Username is required")
-			return
+	return
+}
+
+func canTransition(from, to string) bool {
+	if _, ok := StatusTransitions[to]; !ok {
+		return false
+	}
+	for _, val := range StatusTransitions[from] {
+		if val == to {
+			return true
 		}
-		if Password == "" {
-			err = errors.New("storage-model.Password is required")
+	}
+	return false
+}
+
+// old 为 nil 时按 unique 查询已存在的文档, 存在则更新否则插入
+// 源站没有返回 owner 时已存在的文档必须属于 owner, 源站和已存在的文档都没有 owner 时使用 owner
+func (storage *Storage) save(ctx context.Context, old *Storage, owner bson.ObjectId) (err error) {
+	if old == nil {
+		old = &Storage{}
+		if err = ModelStorage.Query(ctx).Eq("unique", storage.Unique).One(old); err == mgo.ErrNotFound {
+			old = nil
+		} else if err != nil {
 			return
 		}
-		req.SetBasicAuth(Username, Password)
 	}
-	req = req.WithContext(timeoutCtx)
-	if res, err = client.Do(req); err != nil {
+	err = nil
+	if storage.Owner == "" && old != nil && old.Owner != "" && owner != "" && old.Owner != owner {
+		err = ErrStorageNotFound
 		return
 	}
-	defer res.Body.Close()
-	if bodyBytes, err = ioutil.ReadAll(res.Body); err != nil {
+	if storage.Owner == "" && (old == nil || old.Owner == "") {
+		storage.Owner = owner
+	}
+	if old == nil {
+		storage.ID = bson.NewObjectId()
+		storage.New(ctx, ModelStorage, storage, true)
+	} else {
+		storage.ID = old.ID
+		storage.DeletedAt = old.DeletedAt
+		// 引用计数由 Dedup 维护, 不使用源站的值
+		storage.RefCount = old.RefCount
+		storage.Blob = old.Blob
+		storage.PendingGC = old.PendingGC
+		// 源站没有返回 owner 时保留原有的, 避免 $unset
+		if storage.Owner == "" {
+			storage.Owner = old.Owner
+		}
+		if old.Blob != "" {
+			storage.Path = old.Path
+		}
+		if !Changed(storage, old) {
+			return storage.touchUnchanged(ctx, old)
+		}
+		storage.New(ctx, ModelStorage, storage, false)
+		storage.Old = old
+	}
+	if err = storage.Save(); err != nil {
 		return
 	}
+	storage.emitSave(ctx, old)
+	return
+}
 
-	logrus.Debugf("[Storage] %d %s", res.StatusCode, string(bodyBytes))
+// 只缓存成功的结果, 开启 NegativeCacheTTL 时缓存 404
+func (storage *Storage) isCacheable() bool {
+	if len(storage.Errors) == 0 {
+		return true
+	}
+	return NegativeCacheTTL > 0 && storage.isNegative()
+}
+
+// 修改集合名称, 可以使用 "数据库.集合" 的格式, 事件和索引配置不变
+// 需要在 ModelStorage.Update 和读写之前调用, 索引由 ModelStorage.Update 在新的集合上创建
+func SetCollectionName(name string) {
+	if name == "" {
+		return
+	}
+	ModelStorage.Name = name
+}
 
-	if res.StatusCode >= 500 {
-		err = &errs.Error{
-			Message:    "Storage: Status code error",
-			StatusCode: res.StatusCode,
+// 添加 expires_at 的 TTL 索引, mongodb 会删除过期的文档
+// 有 max-age 的正常文档也会被删除, negativeOnly 为 true 时只删除 404 的缓存
+// 需要在 ModelStorage.Update 之前调用
+func EnableExpiresIndex(negativeOnly bool) {
+	index := mgo.Index{
+		Name:        "expires_at_ttl",
+		Key:         []string{"expires_at"},
+		Background:  true,
+		ExpireAfter: time.Second,
+	}
+	if negativeOnly {
+		index.PartialFilter = bson.M{"status_code": http.StatusNotFound}
+	}
+	for i, val := range ModelStorage.Indexs {
+		if val.Name == index.Name {
+			ModelStorage.Indexs[i] = index
+			return
 		}
+	}
+	ModelStorage.Indexs = append(ModelStorage.Indexs, index)
+}
+
+func (storage *Storage) isStale() bool {
+	expiresAt, ok := storage.expiresAt()
+	return ok && time.Now().After(expiresAt)
+}
+
+// 缓存过期的时间, 不会过期时 ok 为 false
+func (storage *Storage) expiresAt() (expiresAt time.Time, ok bool) {
+	if storage.isNegative() {
 		return
 	}
-	if res.StatusCode > 200 {
-		err = ErrStorageNotFound
+	if storage.ExpiresAt != nil {
+		return *storage.ExpiresAt, true
+	}
+	if CacheTTL <= 0 || storage.UpdatedAt == nil {
 		return
 	}
+	return storage.UpdatedAt.Add(CacheTTL), true
+}
 
-	if err = json.Unmarshal(bodyBytes, storage); err != nil {
+func (storage *Storage) URL() (url string, err error) {
+	url, _, err = defaultClient().url(storage.Unique)
+	return
+}
+
+// 没有 SHA256 时不校验
+func (storage *Storage) Verify(data []byte) (err error) {
+	if storage.SHA256 == "" {
 		return
 	}
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), storage.SHA256) {
+		err = ErrStorageChecksum
+	}
 	return
 }
+
+// owner 为空时不限制
+func (storage *Storage) isOwner(owner bson.ObjectId) bool {
+	return owner == "" || storage.Owner == owner
+}
+
+func (storage *Storage) age() time.Duration {
+	if storage.UpdatedAt == nil {
+		return 0
+	}
+	return time.Since(*storage.UpdatedAt)
+}
+
+func (storage *Storage) isNegative() bool {
+	return storage.StatusCode == http.StatusNotFound
+}
+
+func (storage *Storage) isNegativeExpired() bool {
+	if !storage.isNegative() {
+		return false
+	}
+	if NegativeCacheTTL <= 0 || storage.UpdatedAt == nil {
+		return true
+	}
+	return time.Now().After(storage.UpdatedAt.Add(NegativeCacheTTL))
+}
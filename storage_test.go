@@ -0,0 +1,229 @@
+package model
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+type (
+	// 等待 release 之后返回的 Fetcher
+	blockingFetcher struct {
+		started  chan struct{}
+		release  chan struct{}
+		canceled chan struct{}
+	}
+
+	// 返回 storage 的副本
+	staticFetcher struct {
+		storage Storage
+	}
+)
+
+func (fetcher *staticFetcher) Fetch(ctx context.Context, url string, auth bool) (storage *Storage, err error) {
+	val := fetcher.storage
+	storage = &val
+	return
+}
+
+func (fetcher *blockingFetcher) Fetch(ctx context.Context, url string, auth bool) (storage *Storage, err error) {
+	// 重复回源时不再关闭
+	select {
+	case <-fetcher.started:
+	default:
+		close(fetcher.started)
+	}
+	select {
+	case <-fetcher.release:
+	case <-ctx.Done():
+		select {
+		case <-fetcher.canceled:
+		default:
+			close(fetcher.canceled)
+		}
+		err = ctx.Err()
+		return
+	}
+	now := time.Now()
+	storage = &Storage{
+		Path:      "a.jpg",
+		Status:    StatusApproved,
+		CreatedAt: &now,
+		UpdatedAt: &now,
+	}
+	return
+}
+
+func newBlockingClient() (client *Client, fetcher *blockingFetcher) {
+	fetcher = &blockingFetcher{
+		started:  make(chan struct{}),
+		release:  make(chan struct{}),
+		canceled: make(chan struct{}),
+	}
+	client = NewClient(
+		WithOrigin("http://storage.test", "http://path.test"),
+		WithFetcher(fetcher),
+		WithTimeout(5*time.Second),
+	)
+	return
+}
+
+func TestGetSharedCancelFirstWaiter(t *testing.T) {
+	client, fetcher := newBlockingClient()
+	val := "shared/cancel.jpg"
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	err1 := make(chan error, 1)
+	go func() {
+		_, err := client.Get(ctx1, val, false, false)
+		err1 <- err
+	}()
+	<-fetcher.started
+
+	type result struct {
+		storage *Storage
+		err     error
+	}
+	res2 := make(chan result, 1)
+	go func() {
+		storage, err := client.Get(context.Background(), val, false, false)
+		res2 <- result{storage, err}
+	}()
+	// 等待第二个调用方加入同一个回源
+	time.Sleep(50 * time.Millisecond)
+
+	cancel1()
+	if err := <-err1; err == nil {
+		t.Fatal("canceled waiter: expected error")
+	}
+	close(fetcher.release)
+
+	select {
+	case res := <-res2:
+		if res.err != nil {
+			t.Fatalf("second waiter: %v", res.err)
+		}
+		if res.storage == nil || res.storage.Unique != val {
+			t.Fatalf("second waiter: unexpected storage %+v", res.storage)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second waiter: timeout")
+	}
+}
+
+func TestGetOriginOwner(t *testing.T) {
+	owner := bson.NewObjectId()
+	now := time.Now()
+	tests := []struct {
+		origin bson.ObjectId
+		owner  bson.ObjectId
+		found  bool
+	}{
+		{"", "", true},
+		{"", owner, true},
+		{owner, owner, true},
+		{owner, "", true},
+		{bson.NewObjectId(), owner, false},
+	}
+	for _, test := range tests {
+		client := NewClient(
+			WithOrigin("http://storage.test", "http://path.test"),
+			WithFetcher(&staticFetcher{Storage{
+				Path:      "a.jpg",
+				Status:    StatusApproved,
+				Owner:     test.origin,
+				CreatedAt: &now,
+				UpdatedAt: &now,
+			}}),
+		)
+		storage, err := client.GetWithOptions(context.Background(), "owner/a.jpg", GetOptions{Owner: test.owner})
+		if test.found {
+			if err != nil {
+				t.Errorf("origin=%q owner=%q: %v", test.origin, test.owner, err)
+			} else if storage.Owner != test.origin {
+				t.Errorf("origin=%q owner=%q: Owner = %q", test.origin, test.owner, storage.Owner)
+			}
+		} else if err != ErrStorageNotFound {
+			t.Errorf("origin=%q owner=%q: err = %v, want ErrStorageNotFound", test.origin, test.owner, err)
+		}
+	}
+}
+
+func TestGetSharedCancelLastWaiter(t *testing.T) {
+	client, fetcher := newBlockingClient()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := client.Get(ctx, "shared/last.jpg", false, false)
+		errc <- err
+	}()
+	<-fetcher.started
+	cancel()
+	if err := <-errc; err == nil {
+		t.Fatal("expected error")
+	}
+	select {
+	case <-fetcher.canceled:
+	case <-time.After(time.Second):
+		t.Fatal("origin fetch was not canceled after the last waiter left")
+	}
+}
+
+func TestGetSharedCallerDeadline(t *testing.T) {
+	client, fetcher := newBlockingClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := client.Get(ctx, "shared/deadline.jpg", false, false)
+		errc <- err
+	}()
+	<-fetcher.started
+	go func() {
+		// 没有 deadline 的调用方加入后仍然按最早的 deadline 取消
+		client.Get(context.Background(), "shared/deadline.jpg", false, false)
+	}()
+	if err := <-errc; err == nil {
+		t.Fatal("expected error")
+	}
+	select {
+	case <-fetcher.canceled:
+	case <-time.After(time.Second):
+		t.Fatal("origin fetch was not canceled at the caller deadline")
+	}
+}
+
+func TestGetOriginManifestWarning(t *testing.T) {
+	defer func(val bool) { ParseHLS = val }(ParseHLS)
+	ParseHLS = true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not a playlist"))
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	client := NewClient(
+		WithOrigin("http://storage.test", "http://path.test"),
+		WithFetcher(&staticFetcher{Storage{
+			Path:      "a.m3u8",
+			HLS:       server.URL + "/a.m3u8",
+			Status:    StatusApproved,
+			CreatedAt: &now,
+			UpdatedAt: &now,
+		}}),
+	)
+	storage, err := client.Get(context.Background(), "manifest/a.m3u8", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if storage.Err() != nil || len(storage.Errors) != 0 {
+		t.Fatalf("manifest errors should not be in Errors: %v", storage.Errors)
+	}
+	if len(storage.Warnings) != 1 {
+		t.Fatalf("Warnings = %v, want 1", storage.Warnings)
+	}
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/otamoe/gin-server/errs"
+)
+
+var (
+	// 每个文件最多的标签数, 0 不限制
+	MaxTags = 32
+	// 单个标签最大字符数, 0 不限制
+	MaxTagLength = 64
+
+	ErrStorageTagsTooMany = &errs.Error{
+		Message:    "Too many tags",
+		Path:       "tags",
+		Type:       "max",
+		StatusCode: http.StatusBadRequest,
+	}
+
+	ErrStorageTagInvalid = &errs.Error{
+		Message:    "Tag is empty or too long",
+		Path:       "tags",
+		Type:       "invalid",
+		StatusCode: http.StatusBadRequest,
+	}
+)
+
+// 去掉首尾空白和重复的标签, 检查数量和长度
+func (storage *Storage) limitTags() (err error) {
+	if len(storage.Tags) == 0 {
+		return
+	}
+	tags := make([]string, 0, len(storage.Tags))
+	seen := make(map[string]bool, len(storage.Tags))
+	for _, tag := range storage.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || (MaxTagLength > 0 && utf8.RuneCountInString(tag) > MaxTagLength) {
+			ginErr := ErrStorageTagInvalid.Clone()
+			ginErr.Params = map[string]interface{}{"tag": tag, "max": MaxTagLength}
+			return ginErr
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if MaxTags > 0 && len(tags) > MaxTags {
+		ginErr := ErrStorageTagsTooMany.Clone()
+		ginErr.Params = map[string]interface{}{"max": MaxTags}
+		return ginErr
+	}
+	storage.Tags = tags
+	return
+}
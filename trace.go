@@ -0,0 +1,8 @@
+package model
+
+import (
+	"go.opentelemetry.io/otel"
+)
+
+// 没有配置 TracerProvider 时为 otel 全局的 no-op
+var tracer = otel.Tracer("github.com/otamoe/storage-model")
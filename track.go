@@ -0,0 +1,56 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/otamoe/gin-server/errs"
+)
+
+type (
+	// 字幕, 音轨
+	Track struct {
+		// BCP 47 语言代码, 例如 en, zh-Hans, pt-BR
+		Language string `json:"language,omitempty" msgpack:"language,omitempty" bson:"language,omitempty" binding:"omitempty,max=35"`
+		Label    string `json:"label,omitempty" msgpack:"label,omitempty" bson:"label,omitempty" binding:"omitempty,max=128"`
+		Path     string `json:"path" msgpack:"path" bson:"path" binding:"required"`
+		Codec    string `json:"codec,omitempty" msgpack:"codec,omitempty" bson:"codec,omitempty" binding:"omitempty,max=64"`
+	}
+)
+
+var (
+	trackLanguageRegexp = regexp.MustCompile(`^[a-zA-Z]{2,3}(?:-[a-zA-Z0-9]{1,8})*$`)
+
+	ErrStorageTrackInvalid = &errs.Error{
+		Message:    "Track is invalid",
+		Type:       "invalid",
+		StatusCode: http.StatusBadRequest,
+	}
+)
+
+func (storage *Storage) checkTracks() (err error) {
+	if err = checkTracks("subtitles", storage.Subtitles); err != nil {
+		return
+	}
+	err = checkTracks("audio_tracks", storage.AudioTracks)
+	return
+}
+
+func checkTracks(path string, tracks []Track) (err error) {
+	for i, track := range tracks {
+		ginErr := ErrStorageTrackInvalid.Clone()
+		switch {
+		case track.Path == "":
+			ginErr.Path = fmt.Sprintf("%s.%d.path", path, i)
+			ginErr.Type = "required"
+		case track.Language != "" && !trackLanguageRegexp.MatchString(track.Language):
+			ginErr.Path = fmt.Sprintf("%s.%d.language", path, i)
+			ginErr.Value = track.Language
+		default:
+			continue
+		}
+		return ginErr
+	}
+	return
+}
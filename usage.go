@@ -0,0 +1,27 @@
+package model
+
+import (
+	"context"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// 按 type 统计未删除文件的 size 总和
+func UsageByType(ctx context.Context) (usage map[string]int64, err error) {
+	var results []struct {
+		Type string `bson:"_id"`
+		Size int64  `bson:"size"`
+	}
+	pipeline := []bson.M{
+		{"$match": ModelStorage.Query(ctx).NeDeleted().Map()},
+		{"$group": bson.M{"_id": "$type", "size": bson.M{"$sum": "$size"}}},
+	}
+	if err = ModelStorage.DB(ctx).Pipe(pipeline).All(&results); err != nil {
+		return
+	}
+	usage = make(map[string]int64, len(results))
+	for _, result := range results {
+		usage[result.Type] += result.Size
+	}
+	return
+}
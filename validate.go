@@ -0,0 +1,70 @@
+package model
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/otamoe/gin-server/errs"
+	"github.com/sirupsen/logrus"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+var (
+	ErrStorageInvalid = &errs.Error{
+		Message:    "Storage: Invalid origin response",
+		Path:       "storage",
+		Type:       "invalid",
+		StatusCode: http.StatusBadGateway,
+	}
+
+	// 回源结果使用的 binding 规则校验, 和 gin-server 的 validator 一致
+	storageValidate = newStorageValidate()
+)
+
+func newStorageValidate() (validate *validator.Validate) {
+	validate = validator.New()
+	validate.SetTagName("binding")
+	validate.RegisterValidation("objectid", func(fl validator.FieldLevel) bool {
+		switch val := fl.Field().Interface().(type) {
+		case bson.ObjectId:
+			return val.Valid()
+		case string:
+			return bson.IsObjectIdHex(val)
+		}
+		return false
+	})
+	return
+}
+
+// 校验回源的文档, _id, created_at, updated_at 在保存时生成, 不校验
+func (storage *Storage) validate() (err error) {
+	if err = storageValidate.StructExcept(storage, "ID", "CreatedAt", "UpdatedAt"); err == nil {
+		return
+	}
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok || len(validationErrors) == 0 {
+		return wrapError(ErrStorageInvalid, err)
+	}
+	fieldError := validationErrors[0]
+	wrapped := wrapError(ErrStorageInvalid, err)
+	wrapped.GinError.Path = strings.TrimPrefix(fieldError.Namespace(), "Storage.")
+	wrapped.GinError.Type = fieldError.Tag()
+	wrapped.GinError.Value = fieldError.Value()
+	if param := fieldError.Param(); param != "" {
+		wrapped.GinError.Params = map[string]interface{}{"param": param}
+	}
+	return wrapped
+}
+
+// 源站没有返回 status 时使用 DefaultStatus, StrictStatus 时由 validate 返回错误
+func (storage *Storage) defaultStatus() {
+	if storage.Status != "" || StrictStatus || DefaultStatus == "" {
+		return
+	}
+	Logger.WithFields(logrus.Fields{
+		"unique": storage.Unique,
+		"status": DefaultStatus,
+	}).Warn("[Storage] origin status is empty, use default status")
+	storage.Status = DefaultStatus
+}
@@ -0,0 +1,31 @@
+package model
+
+type (
+	// 同一个文件的不同分辨率
+	Variant struct {
+		Path    string `json:"path" msgpack:"path" bson:"path" binding:"required"`
+		Width   int    `json:"width,omitempty" msgpack:"width,omitempty" bson:"width,omitempty" binding:"omitempty,min=0,max=32767"`
+		Height  int    `json:"height,omitempty" msgpack:"height,omitempty" bson:"height,omitempty" binding:"omitempty,min=0,max=32767"`
+		Size    int64  `json:"size,omitempty" msgpack:"size,omitempty" bson:"size,omitempty" binding:"omitempty,min=0"`
+		Type    string `json:"type,omitempty" msgpack:"type,omitempty" bson:"type,omitempty" binding:"omitempty,max=32"`
+		SubType string `json:"sub_type,omitempty" msgpack:"sub_type,omitempty" bson:"sub_type,omitempty" binding:"omitempty,max=64"`
+	}
+)
+
+// 宽度不小于 width 的最小的 variant, 都小于 width 时返回最大的, 没有 variant 时返回 nil
+func (storage *Storage) Variant(width int) (variant *Variant) {
+	var largest *Variant
+	for i := range storage.Variants {
+		val := &storage.Variants[i]
+		if val.Width >= width && (variant == nil || val.Width < variant.Width) {
+			variant = val
+		}
+		if largest == nil || val.Width > largest.Width {
+			largest = val
+		}
+	}
+	if variant == nil {
+		variant = largest
+	}
+	return
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/globalsign/mgo"
+	"github.com/otamoe/gin-server/errs"
+	mgoModel "github.com/otamoe/mgo-model"
+)
+
+type (
+	// 更新时附加 version 条件的 model
+	versionModel struct {
+		*mgoModel.Model
+		version int64
+	}
+)
+
+var ErrConcurrentModification error = &errs.Error{
+	Message:    "Storage: Concurrent modification",
+	Path:       "version",
+	Type:       "conflict",
+	StatusCode: http.StatusConflict,
+}
+
+func (model *versionModel) Query(ctx context.Context) (query *mgoModel.Query) {
+	query = model.Model.Query(ctx)
+	if model.version == 0 {
+		// 兼容没有 version 字段的旧文档
+		query.In("version", []interface{}{int64(0), nil})
+	} else {
+		query.Eq("version", model.version)
+	}
+	return
+}
+
+// DocumentBase.Save 调用的是 DocumentBase.Update, 这里需要覆盖
+func (storage *Storage) Save() (err error) {
+	if storage.IsNew {
+		err = storage.Insert()
+	} else {
+		err = storage.Update()
+	}
+	if err != nil {
+		return
+	}
+	storage.markClean()
+	return
+}
+
+// Update 仅在储存的 version 与读取时一致时写入, 并递增 version
+func (storage *Storage) Update() (err error) {
+	old, ok := storage.Old.(*Storage)
+	model, ok2 := storage.Model.(*mgoModel.Model)
+	if !ok || !ok2 {
+		return storage.DocumentBase.Update()
+	}
+	storage.Model = &versionModel{Model: model, version: old.Version}
+	storage.Version = old.Version + 1
+	err = storage.DocumentBase.Update()
+	storage.Model = model
+	if err != nil {
+		storage.Version = old.Version
+		if err == mgo.ErrNotFound {
+			err = ErrConcurrentModification
+		}
+	}
+	return
+}
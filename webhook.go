@@ -0,0 +1,123 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type (
+	// webhook 的 json 内容
+	WebhookPayload struct {
+		Unique    string     `json:"unique"`
+		Kind      ChangeKind `json:"kind"`
+		Status    string     `json:"status,omitempty"`
+		OldStatus string     `json:"old_status,omitempty"`
+		Timestamp int64      `json:"timestamp"`
+	}
+)
+
+// 状态变化 (OldStatus 不为空且 != Status) 时 POST WebhookURL, 插入不发送, 签名方式:
+// X-Storage-Signature: sha256=hex(HMAC-SHA256(WebhookSecret, body)), WebhookSecret 为空时不签名
+var (
+	WebhookURL    string
+	WebhookSecret []byte
+
+	WebhookTimeout        = 10 * time.Second
+	WebhookMaxRetries     = 5
+	WebhookRetryBaseDelay = time.Second
+)
+
+// 状态变化时在后台发送, 包括 UpdateStatus, Complete 和回源更新的状态, 不阻塞修改状态
+func dispatchWebhook(ctx context.Context, event ChangeEvent) {
+	if WebhookURL == "" || event.OldStatus == "" || event.OldStatus == event.Status {
+		return
+	}
+	body, err := json.Marshal(WebhookPayload{
+		Unique:    event.Unique,
+		Kind:      event.Kind,
+		Status:    event.Status,
+		OldStatus: event.OldStatus,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return
+	}
+	url := WebhookURL
+	go func() {
+		ctx := detachedContext{ctx}
+		for i := 0; ; i++ {
+			retry, err := postWebhook(ctx, url, body)
+			if err == nil {
+				return
+			}
+			entry := Logger.WithError(err).WithFields(logrus.Fields{
+				"unique":  event.Unique,
+				"attempt": i + 1,
+			})
+			if !retry || i >= WebhookMaxRetries {
+				entry.Error("[Storage] webhook")
+				return
+			}
+			entry.Warn("[Storage] webhook retry")
+			time.Sleep(webhookBackoff(i))
+		}
+	}()
+}
+
+func postWebhook(ctx context.Context, url string, body []byte) (retry bool, err error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, WebhookTimeout)
+	defer cancel()
+	var req *http.Request
+	if req, err = http.NewRequest("POST", url, bytes.NewReader(body)); err != nil {
+		return
+	}
+	req = req.WithContext(timeoutCtx)
+	req.Header.Set("Content-Type", "application/json")
+	if len(WebhookSecret) != 0 {
+		req.Header.Set("X-Storage-Signature", "sha256="+signWebhook(body, WebhookSecret))
+	}
+	var res *http.Response
+	if res, err = defaultClient().getHTTPClient().Do(req); err != nil {
+		retry = true
+		return
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return
+	}
+	retry = res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusRequestTimeout
+	err = fmt.Errorf("storage-model.webhook status code %d", res.StatusCode)
+	return
+}
+
+func signWebhook(body, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 指数退避 + 随机抖动 [delay/2, delay)
+func webhookBackoff(i int) (delay time.Duration) {
+	delay = WebhookRetryBaseDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	if i > 16 {
+		i = 16
+	}
+	delay = delay << uint(i)
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	return
+}
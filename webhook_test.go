@@ -0,0 +1,52 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookStatusChange(t *testing.T) {
+	received := make(chan WebhookPayload, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Storage-Signature") != "sha256="+signWebhook(body, []byte("secret")) {
+			t.Error("invalid signature")
+		}
+		var payload WebhookPayload
+		json.Unmarshal(body, &payload)
+		received <- payload
+	}))
+	defer server.Close()
+
+	defer func(url string, secret []byte) { WebhookURL, WebhookSecret = url, secret }(WebhookURL, WebhookSecret)
+	WebhookURL = server.URL
+	WebhookSecret = []byte("secret")
+
+	ctx := context.Background()
+	// 状态没有变化不发送
+	emitChange(ctx, ChangeEvent{Unique: "a", Kind: ChangeSave, Status: StatusApproved, OldStatus: StatusApproved})
+	emitChange(ctx, ChangeEvent{Unique: "b", Kind: ChangeDelete, Status: StatusApproved, OldStatus: StatusApproved})
+	// 插入不是状态变化
+	emitChange(ctx, ChangeEvent{Unique: "d", Kind: ChangeSave, Status: StatusPending})
+	// 回源更新的状态
+	emitChange(ctx, ChangeEvent{Unique: "c", Kind: ChangeSave, Status: StatusBanned, OldStatus: StatusApproved})
+
+	select {
+	case payload := <-received:
+		if payload.Unique != "c" || payload.Kind != ChangeSave || payload.Status != StatusBanned || payload.OldStatus != StatusApproved {
+			t.Fatalf("unexpected payload %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	select {
+	case payload := <-received:
+		t.Fatalf("unexpected webhook %+v", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}